@@ -0,0 +1,274 @@
+// Package config is the registry of server parameters. Every parameter is
+// declared once in params.go with its type, default and whether it can be
+// changed at runtime; the same table backs command line flags, redis.conf
+// files, CONFIG GET/SET and CONFIG REWRITE.
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
+)
+
+// Kind describes how a parameter value is parsed and shown.
+type Kind int
+
+const (
+	String  Kind = iota
+	Int          // integer within [Min, Max]
+	Bool         // yes or no
+	Memory       // byte count written as e.g. 64mb, shown in bytes
+	Enum         // one of Values
+	Special      // validated by the parameter's own normalize function
+)
+
+type Param struct {
+	Name    string
+	Alias   string
+	Kind    Kind
+	Default string
+	Usage   string
+	// Min and Max bound Int and Memory values. Max 0 means unbounded.
+	Min, Max int64
+	Values   []string
+	// Immutable parameters can only be set on the command line or in the
+	// config file.
+	Immutable bool
+	// Multi marks values made of several words, such as bind, that are
+	// written to the config file without quoting.
+	Multi bool
+
+	// normalize validates a Special value given the current one and returns
+	// its canonical form.
+	normalize func(value, current string) (string, error)
+	apply     func(value string) error
+	value     string
+}
+
+// Config holds the current value of every parameter.
+type Config struct {
+	mu     sync.RWMutex
+	params []*Param
+	byName map[string]*Param
+	// file is the config file the server was started with, if any.
+	file string
+}
+
+// New returns a registry with every parameter at its default value.
+func New() *Config {
+	c := &Config{byName: map[string]*Param{}}
+	for _, p := range params() {
+		value, err := p.parse(p.Default, "")
+		if err != nil {
+			panic(fmt.Sprintf("config: bad default for %s: %v", p.Name, err))
+		}
+		p.value = value
+		c.params = append(c.params, &p)
+		c.byName[p.Name] = &p
+		if p.Alias != "" {
+			c.byName[p.Alias] = &p
+		}
+	}
+	return c
+}
+
+// Params returns the parameters in declaration order.
+func (c *Config) Params() []*Param {
+	return c.params
+}
+
+func (c *Config) lookup(name string) (*Param, bool) {
+	p, ok := c.byName[strings.ToLower(name)]
+	return p, ok
+}
+
+// Get returns the current value of a parameter in its canonical form.
+func (c *Config) Get(name string) string {
+	p, ok := c.lookup(name)
+	if !ok {
+		panic("config: unknown parameter " + name)
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return p.value
+}
+
+// Int returns the value of an Int or Memory parameter.
+func (c *Config) Int(name string) int64 {
+	n, _ := strconv.ParseInt(c.Get(name), 10, 64)
+	return n
+}
+
+// Bool returns the value of a Bool parameter.
+func (c *Config) Bool(name string) bool {
+	return c.Get(name) == "yes"
+}
+
+// OnChange registers the function that applies a parameter to the running
+// server. It is called by Apply at startup and by every CONFIG SET, with the
+// registry locked, so it must not read other parameters.
+func (c *Config) OnChange(name string, apply func(value string) error) {
+	p, ok := c.lookup(name)
+	if !ok {
+		panic("config: unknown parameter " + name)
+	}
+	p.apply = apply
+}
+
+// Apply runs every registered OnChange function with the current value.
+func (c *Config) Apply() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, p := range c.params {
+		if p.apply == nil {
+			continue
+		}
+		if err := p.apply(p.value); err != nil {
+			return fmt.Errorf("%s: %w", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Set changes a parameter during startup, from a flag or the config file.
+// Immutable parameters are allowed and nothing is applied yet.
+func (c *Config) Set(name, value string) error {
+	p, ok := c.lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown parameter '%s'", name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	parsed, err := p.parse(value, p.value)
+	if err != nil {
+		return err
+	}
+	p.value = parsed
+	return nil
+}
+
+// SetLive implements CONFIG SET. All pairs are validated before anything
+// changes, and if applying one of them fails the ones already applied are
+// restored, so the command either takes effect as a whole or not at all.
+func (c *Config) SetLive(pairs [][2]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type change struct {
+		param    *Param
+		old, new string
+	}
+	changes := make([]change, 0, len(pairs))
+	seen := map[*Param]bool{}
+	for _, pair := range pairs {
+		p, ok := c.lookup(pair[0])
+		if !ok {
+			return resp.NewError("Unknown option or number of arguments for CONFIG SET - '%s'", pair[0])
+		}
+		if seen[p] {
+			return setFailed(pair[0], "duplicate parameter")
+		}
+		seen[p] = true
+		if p.Immutable {
+			return setFailed(pair[0], "can't set immutable config")
+		}
+		parsed, err := p.parse(pair[1], p.value)
+		if err != nil {
+			return setFailed(pair[0], err.Error())
+		}
+		changes = append(changes, change{param: p, old: p.value, new: parsed})
+	}
+
+	for i, ch := range changes {
+		if ch.param.apply != nil {
+			if err := ch.param.apply(ch.new); err != nil {
+				for _, done := range changes[:i] {
+					if done.param.apply != nil {
+						_ = done.param.apply(done.old)
+					}
+					done.param.value = done.old
+				}
+				return setFailed(ch.param.Name, err.Error())
+			}
+		}
+		ch.param.value = ch.new
+	}
+	return nil
+}
+
+func setFailed(name, reason string) error {
+	return resp.NewError("CONFIG SET failed (possibly related to argument '%s') - %s", name, reason)
+}
+
+// Match implements CONFIG GET: it returns the name and value of every
+// parameter matching pattern, sorted by name. Aliases are only reported
+// when asked for by their exact name.
+func (c *Config) Match(pattern string) [][2]string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var matches [][2]string
+	lower := strings.ToLower(pattern)
+	for _, p := range c.params {
+		if utils.StringMatch(pattern, p.Name, true) {
+			matches = append(matches, [2]string{p.Name, p.value})
+		}
+		if p.Alias != "" && p.Alias == lower {
+			matches = append(matches, [2]string{p.Alias, p.value})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i][0] < matches[j][0] })
+	return matches
+}
+
+// parse validates value and returns its canonical form.
+func (p *Param) parse(value, current string) (string, error) {
+	switch p.Kind {
+	case Int:
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("argument couldn't be parsed into an integer")
+		}
+		return p.checkRange(n)
+	case Memory:
+		n, err := utils.ParseMemory(value)
+		if err != nil {
+			return "", fmt.Errorf("argument must be a memory value")
+		}
+		return p.checkRange(n)
+	case Bool:
+		switch strings.ToLower(value) {
+		case "yes":
+			return "yes", nil
+		case "no":
+			return "no", nil
+		}
+		return "", fmt.Errorf("argument must be 'yes' or 'no'")
+	case Enum:
+		lower := strings.ToLower(value)
+		for _, v := range p.Values {
+			if v == lower {
+				return v, nil
+			}
+		}
+		return "", fmt.Errorf("argument(s) must be one of the following: %s", strings.Join(p.Values, ", "))
+	case Special:
+		return p.normalize(value, current)
+	}
+	return value, nil
+}
+
+func (p *Param) checkRange(n int64) (string, error) {
+	if n < p.Min || (p.Max != 0 && n > p.Max) {
+		if p.Max != 0 {
+			return "", fmt.Errorf("argument must be between %d and %d inclusive", p.Min, p.Max)
+		}
+		return "", fmt.Errorf("argument must be greater or equal to %d", p.Min)
+	}
+	return strconv.FormatInt(n, 10), nil
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// CONFIG SET takes effect as a whole or not at all: a value that does not
+// validate changes nothing, and a failing OnChange restores the parameters
+// applied before it, running their OnChange again with the old value.
+func TestSetLive(t *testing.T) {
+	tests := []struct {
+		name    string
+		pairs   [][2]string
+		wantErr bool
+		applied []string // OnChange calls, in order
+		want    map[string]string
+	}{
+		{
+			"applied",
+			[][2]string{{"hz", "20"}, {"maxmemory", "1mb"}},
+			false,
+			[]string{"hz 20", "maxmemory 1048576"},
+			map[string]string{"hz": "20", "maxmemory": "1048576", "timeout": "0"},
+		},
+		{
+			"failing OnChange rolls back",
+			[][2]string{{"hz", "20"}, {"maxmemory", "1mb"}, {"timeout", "13"}},
+			true,
+			[]string{"hz 20", "maxmemory 1048576", "timeout 13", "hz 10", "maxmemory 0"},
+			map[string]string{"hz": "10", "maxmemory": "0", "timeout": "0"},
+		},
+		{
+			"the first OnChange failing",
+			[][2]string{{"timeout", "13"}, {"hz", "20"}},
+			true,
+			[]string{"timeout 13"},
+			map[string]string{"hz": "10", "timeout": "0"},
+		},
+		{
+			"invalid value",
+			[][2]string{{"hz", "20"}, {"maxmemory", "lots"}},
+			true,
+			nil,
+			map[string]string{"hz": "10", "maxmemory": "0"},
+		},
+		{
+			"unknown parameter",
+			[][2]string{{"hz", "20"}, {"no-such-parameter", "1"}},
+			true,
+			nil,
+			map[string]string{"hz": "10"},
+		},
+		{
+			"immutable parameter",
+			[][2]string{{"hz", "20"}, {"port", "7000"}},
+			true,
+			nil,
+			map[string]string{"hz": "10", "port": "6379"},
+		},
+		{
+			"duplicate parameter",
+			[][2]string{{"hz", "20"}, {"HZ", "30"}},
+			true,
+			nil,
+			map[string]string{"hz": "10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			var applied []string
+			for _, name := range []string{"hz", "maxmemory", "timeout"} {
+				c.OnChange(name, func(value string) error {
+					applied = append(applied, name+" "+value)
+					if name == "timeout" && value == "13" {
+						return errors.New("unlucky")
+					}
+					return nil
+				})
+			}
+
+			err := c.SetLive(tt.pairs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SetLive() = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(applied, tt.applied) {
+				t.Errorf("OnChange calls %q, want %q", applied, tt.applied)
+			}
+			for name, want := range tt.want {
+				if got := c.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetLiveError(t *testing.T) {
+	c := New()
+	c.OnChange("hz", func(string) error { return fmt.Errorf("cannot") })
+	err := c.SetLive([][2]string{{"hz", "20"}})
+	want := "ERR CONFIG SET failed (possibly related to argument 'hz') - cannot"
+	if err == nil || err.Error() != want {
+		t.Fatalf("SetLive() = %v, want %q", err, want)
+	}
+}
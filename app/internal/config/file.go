@@ -0,0 +1,217 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+)
+
+const rewriteSignature = "# Generated by CONFIG REWRITE"
+
+// LoadFile reads a redis.conf style file: one "name value..." directive
+// per line, with # comments and values quoted as in inline commands.
+// Directives may repeat; the last one wins, except for parameters such as
+// client-output-buffer-limit that accumulate.
+func (c *Config) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	c.file = abs
+
+	for i, line := range strings.Split(string(data), "\n") {
+		name, args, ok, err := parseLine(line)
+		if err != nil {
+			return fmt.Errorf("line %d: %q: %w", i+1, line, err)
+		}
+		if !ok {
+			continue
+		}
+		if err := c.Set(name, strings.Join(args, " ")); err != nil {
+			return fmt.Errorf("line %d: %q: %w", i+1, line, err)
+		}
+	}
+	return nil
+}
+
+// File returns the absolute path of the loaded config file, or "".
+func (c *Config) File() string {
+	return c.file
+}
+
+// parseLine splits a config line into its directive and arguments. ok is
+// false for blank lines and comments.
+func parseLine(line string) (string, []string, bool, error) {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+		return "", nil, false, nil
+	}
+	args, balanced := resp.SplitArgs(trimmed)
+	if !balanced {
+		return "", nil, false, errors.New("unbalanced quotes in configuration line")
+	}
+	if len(args) < 2 {
+		return "", nil, false, errors.New("wrong number of arguments")
+	}
+	return strings.ToLower(args[0]), args[1:], true, nil
+}
+
+// Rewrite implements CONFIG REWRITE. The first line setting each parameter
+// is updated in place and later duplicates are dropped; comments, blank
+// lines and unknown lines are kept. Parameters that differ from their
+// default and are not in the file yet are appended at the end. The new file
+// replaces the old one atomically.
+func (c *Config) Rewrite() error {
+	if c.file == "" {
+		return errors.New("The server is running without a config file")
+	}
+	data, err := os.ReadFile(c.file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		lines = nil
+	}
+	written := map[*Param]bool{}
+	var out []string
+	for _, line := range lines {
+		name, _, ok, _ := parseLine(line)
+		p, known := c.byName[name]
+		if !ok || !known {
+			out = append(out, line)
+			continue
+		}
+		if written[p] {
+			continue
+		}
+		written[p] = true
+		out = append(out, p.configLine())
+	}
+
+	var added []string
+	for _, p := range c.params {
+		if !written[p] && p.value != p.defaultValue() {
+			added = append(added, p.configLine())
+		}
+	}
+	if len(added) > 0 {
+		hasSignature := false
+		for _, line := range out {
+			if line == rewriteSignature {
+				hasSignature = true
+				break
+			}
+		}
+		if !hasSignature {
+			out = append(out, rewriteSignature)
+		}
+		out = append(out, added...)
+	}
+
+	return writeFileAtomic(c.file, []byte(strings.Join(out, "\n")+"\n"))
+}
+
+// configLine renders the current value as a config file directive.
+func (p *Param) configLine() string {
+	value := p.value
+	switch {
+	case p.Kind == Memory:
+		value = formatMemory(value)
+	case !p.Multi || value == "":
+		value = quote(value)
+	}
+	return p.Name + " " + value
+}
+
+// defaultValue is the canonical form of the default.
+func (p *Param) defaultValue() string {
+	value, _ := p.parse(p.Default, "")
+	return value
+}
+
+// formatMemory writes a byte count with the largest exact unit, as Redis
+// does when rewriting its config.
+func formatMemory(bytes string) string {
+	n, err := strconv.ParseInt(bytes, 10, 64)
+	if err != nil || n == 0 {
+		return bytes
+	}
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}} {
+		if n%unit.size == 0 {
+			return strconv.FormatInt(n/unit.size, 10) + unit.suffix
+		}
+	}
+	return bytes
+}
+
+// quote wraps a value in double quotes when it would not survive being
+// split back into arguments.
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t\r\n\"'\\") {
+		return value
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".redis-conf-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
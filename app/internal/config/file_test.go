@@ -0,0 +1,175 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		want     map[string]string
+	}{
+		{"directives", "port 7000\nmaxmemory 1mb\n", map[string]string{"port": "7000", "maxmemory": "1048576"}},
+		{"comments and blank lines", "# port 1\n\n   # hz 2\nport 7000\n", map[string]string{"port": "7000", "hz": "10"}},
+		{"quoted value", `dir "/tmp/my dir"`, map[string]string{"dir": "/tmp/my dir"}},
+		{"case of the name", "HZ 20", map[string]string{"hz": "20"}},
+		{"alias", "slaveof 127.0.0.1 6380", map[string]string{"replicaof": "127.0.0.1 6380"}},
+		{"last one wins", "hz 20\nhz 30\n", map[string]string{"hz": "30"}},
+		{
+			"client-output-buffer-limit accumulates",
+			"client-output-buffer-limit replica 1mb 512kb 10\nclient-output-buffer-limit pubsub 2mb 1mb 20\n",
+			map[string]string{"client-output-buffer-limit": "normal 0 0 0 replica 1048576 524288 10 pubsub 2097152 1048576 20"},
+		},
+		{
+			"a later line overrides one class only",
+			"client-output-buffer-limit replica 1mb 512kb 10\nclient-output-buffer-limit slave 3mb 2mb 30\n",
+			map[string]string{"client-output-buffer-limit": "normal 0 0 0 replica 3145728 2097152 30 pubsub 33554432 8388608 60"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			path := writeConfig(t, tt.contents)
+			if err := c.LoadFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if c.File() != path {
+				t.Errorf("File() = %q, want %q", c.File(), path)
+			}
+			for name, want := range tt.want {
+				if got := c.Get(name); got != want {
+					t.Errorf("%s = %q, want %q", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	for _, contents := range []string{
+		"no-such-parameter yes",
+		"port",
+		`dir "/tmp`,
+		"hz 1000",
+		"maxmemory-policy sometimes",
+		"client-output-buffer-limit replica 1mb",
+	} {
+		if err := New().LoadFile(writeConfig(t, contents)); err == nil {
+			t.Errorf("%q was accepted", contents)
+		}
+	}
+	if err := New().LoadFile(filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Error("a missing file was accepted")
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		contents string
+		load     bool // load the file first, which unknown lines prevent
+		set      [][2]string
+		want     string
+	}{
+		{
+			"unchanged",
+			"# Redis configuration\nport 7000\n",
+			true,
+			nil,
+			"# Redis configuration\nport 7000\n",
+		},
+		{
+			"comments, blank and unknown lines are kept",
+			"# Redis configuration\n\nhz 20\n  # indented comment\nenable-debug-command local\nhz 30\n",
+			false,
+			[][2]string{{"hz", "40"}},
+			"# Redis configuration\n\nhz 40\n  # indented comment\nenable-debug-command local\n",
+		},
+		{
+			"parameters not in the file are appended",
+			"# Redis configuration\nport 7000\n",
+			true,
+			[][2]string{{"maxmemory", "100mb"}, {"dir", "/tmp/my dir"}},
+			"# Redis configuration\nport 7000\n" + rewriteSignature + "\ndir \"/tmp/my dir\"\nmaxmemory 100mb\n",
+		},
+		{
+			"the signature is written once",
+			"port 7000\n" + rewriteSignature + "\nhz 20\n",
+			true,
+			[][2]string{{"timeout", "60"}},
+			"port 7000\n" + rewriteSignature + "\nhz 20\ntimeout 60\n",
+		},
+		{
+			"empty file",
+			"",
+			true,
+			[][2]string{{"hz", "20"}},
+			rewriteSignature + "\nhz 20\n",
+		},
+		{
+			"accumulated client-output-buffer-limit lines are merged",
+			"client-output-buffer-limit replica 1mb 512kb 10\n# pubsub\nclient-output-buffer-limit pubsub 2mb 1mb 20\n",
+			true,
+			nil,
+			"client-output-buffer-limit normal 0 0 0 replica 1048576 524288 10 pubsub 2097152 1048576 20\n# pubsub\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New()
+			path := writeConfig(t, tt.contents)
+			if tt.load {
+				if err := c.LoadFile(path); err != nil {
+					t.Fatal(err)
+				}
+			} else {
+				c.file = path
+			}
+			if err := c.SetLive(tt.set); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.Rewrite(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Fatalf("rewrote\n%s\nwant\n%s", got, tt.want)
+			}
+			if !tt.load {
+				return
+			}
+
+			// The rewritten file loads back to the same values.
+			loaded := New()
+			if err := loaded.LoadFile(path); err != nil {
+				t.Fatal(err)
+			}
+			for _, p := range c.Params() {
+				if got, want := loaded.Get(p.Name), c.Get(p.Name); got != want {
+					t.Errorf("%s loads back as %q, want %q", p.Name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRewriteWithoutFile(t *testing.T) {
+	if err := New().Rewrite(); err == nil {
+		t.Fatal("Rewrite succeeded without a config file")
+	}
+}
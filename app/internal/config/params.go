@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
+)
+
+// params declares every parameter the server understands.
+func params() []Param {
+	return []Param{
+		{Name: "port", Kind: Int, Default: "6379", Max: 65535, Immutable: true,
+			Usage: "Port for redis server (0 disables plain TCP)"},
+		{Name: "bind", Kind: String, Default: "* -::*", Immutable: true, Multi: true,
+			Usage: "Space separated addresses to listen on; a leading - marks an optional address"},
+		{Name: "replicaof", Alias: "slaveof", Kind: String, Immutable: true, Multi: true,
+			Usage: "Defines replica of master redis server"},
+		{Name: "dir", Kind: String, Default: "/tmp",
+			Usage: "The path to the directory where the RDB file is stored"},
+		{Name: "dbfilename", Kind: String, Default: "redis-data.rdb",
+			Usage: "The name of the RDB file"},
+		{Name: "proto-max-bulk-len", Kind: Memory, Default: "512mb", Min: 1024 * 1024,
+			Usage: "Maximum size of a single bulk string in a request"},
+		{Name: "client-output-buffer-limit", Kind: Special, Multi: true,
+			Default:   "normal 0 0 0 replica 256mb 64mb 60 pubsub 32mb 8mb 60",
+			normalize: normalizeOutputBufferLimit,
+			Usage:     "Output buffer limits per client class: <class> <hard> <soft> <seconds> ..."},
+		{Name: "tls-port", Kind: Int, Default: "0", Max: 65535, Immutable: true,
+			Usage: "Port for TLS connections (0 disables TLS)"},
+		{Name: "tls-cert-file", Kind: String, Immutable: true,
+			Usage: "Server certificate (PEM)"},
+		{Name: "tls-key-file", Kind: String, Immutable: true,
+			Usage: "Private key for tls-cert-file (PEM)"},
+		{Name: "tls-ca-cert-file", Kind: String, Immutable: true,
+			Usage: "CA bundle used to verify clients and the master"},
+		{Name: "tls-auth-clients", Kind: Enum, Default: "yes", Values: []string{"yes", "no", "optional"}, Immutable: true,
+			Usage: "Require TLS client certificates: yes, no or optional"},
+		{Name: "tls-replication", Kind: Bool, Default: "no", Immutable: true,
+			Usage: "Connect to the master over TLS: yes or no"},
+		{Name: "unixsocket", Kind: String, Immutable: true,
+			Usage: "Path of a Unix domain socket to listen on"},
+		{Name: "unixsocketperm", Kind: Special, Default: "0", Immutable: true,
+			normalize: normalizeOctal,
+			Usage:     "Octal permissions of the Unix socket file, e.g. 700"},
+		{Name: "tcp-keepalive", Kind: Int, Default: "300",
+			Usage: "TCP keepalive interval in seconds (0 disables)"},
+		{Name: "maxclients", Kind: Int, Default: "10000", Min: 1,
+			Usage: "Maximum number of connected clients"},
+		{Name: "timeout", Kind: Int, Default: "0",
+			Usage: "Close clients idle for this many seconds (0 disables)"},
+		{Name: "loglevel", Kind: Enum, Default: "notice", Values: []string{"debug", "verbose", "notice", "warning"},
+			Usage: "Log verbosity: debug, verbose, notice or warning"},
+		{Name: "logfile", Kind: String, Immutable: true,
+			Usage: "Log to this file instead of stdout"},
+		{Name: "databases", Kind: Int, Default: "16", Min: 1, Immutable: true,
+			Usage: "Number of logical databases, selected with SELECT"},
+		{Name: "hz", Kind: Int, Default: "10", Min: 1, Max: 500,
+			Usage: "How many times a second the server samples keys with a TTL to expire them"},
+		{Name: "maxmemory", Kind: Memory, Default: "0",
+			Usage: "Memory limit for the keys (0 for no limit), enforced by maxmemory-policy"},
+		{Name: "maxmemory-policy", Kind: Enum, Default: "noeviction",
+			Values: []string{"noeviction", "allkeys-lru", "volatile-lru", "allkeys-lfu", "volatile-lfu", "allkeys-random", "volatile-random", "volatile-ttl"},
+			Usage:  "Which keys to evict over maxmemory; noeviction refuses writes instead"},
+		{Name: "maxmemory-samples", Kind: Int, Default: "5", Min: 1, Max: 64,
+			Usage: "Keys sampled per database to pick each key to evict"},
+		{Name: "lfu-log-factor", Kind: Int, Default: "10",
+			Usage: "How many accesses it takes to raise the LFU counter of a key"},
+		{Name: "lfu-decay-time", Kind: Int, Default: "1",
+			Usage: "Minutes without access for the LFU counter of a key to drop by one"},
+		{Name: "metrics-port", Kind: Int, Default: "0", Max: 65535, Immutable: true,
+			Usage: "Port for the Prometheus /metrics HTTP endpoint (0 disables it)"},
+	}
+}
+
+// outputBufferClasses are the client classes of client-output-buffer-limit,
+// in the order Redis shows them. "slave" is accepted for "replica".
+var outputBufferClasses = []string{"normal", "replica", "pubsub"}
+
+// normalizeOutputBufferLimit merges "<class> <hard> <soft> <seconds>" groups
+// into the current limits, so each class can be set on its own as in
+// redis.conf.
+func normalizeOutputBufferLimit(value, current string) (string, error) {
+	limits := map[string][3]int64{}
+	if current != "" {
+		var err error
+		if limits, err = OutputBufferLimits(current); err != nil {
+			return "", err
+		}
+	}
+
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields)%4 != 0 {
+		return "", fmt.Errorf("wrong number of arguments")
+	}
+	for i := 0; i < len(fields); i += 4 {
+		class := strings.ToLower(fields[i])
+		if class == "slave" {
+			class = "replica"
+		}
+		if class != "normal" && class != "replica" && class != "pubsub" {
+			return "", fmt.Errorf("invalid client class '%s'", fields[i])
+		}
+		_, hard, soft, seconds, err := utils.ParseOutputBufferLimit(strings.Join(fields[i:i+4], " "))
+		if err != nil {
+			return "", err
+		}
+		limits[class] = [3]int64{hard, soft, seconds}
+	}
+
+	var parts []string
+	for _, class := range outputBufferClasses {
+		l := limits[class]
+		parts = append(parts, fmt.Sprintf("%s %d %d %d", class, l[0], l[1], l[2]))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// OutputBufferLimits parses a canonical client-output-buffer-limit value
+// into hard, soft and soft-seconds limits per class.
+func OutputBufferLimits(value string) (map[string][3]int64, error) {
+	fields := strings.Fields(value)
+	if len(fields)%4 != 0 {
+		return nil, fmt.Errorf("invalid client-output-buffer-limit %q", value)
+	}
+	limits := map[string][3]int64{}
+	for i := 0; i < len(fields); i += 4 {
+		class, hard, soft, seconds, err := utils.ParseOutputBufferLimit(strings.Join(fields[i:i+4], " "))
+		if err != nil {
+			return nil, err
+		}
+		limits[class] = [3]int64{hard, soft, seconds}
+	}
+	return limits, nil
+}
+
+func normalizeOctal(value, _ string) (string, error) {
+	n, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || n > 0o777 {
+		return "", fmt.Errorf("argument must be an octal file mode")
+	}
+	return strconv.FormatUint(n, 8), nil
+}
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -8,64 +9,200 @@ import (
 	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/codecrafters-io/redis-starter-go/app/internal/config"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/exchange"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/output"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
 )
 
-type DB struct {
-	Store       *Store
+// Instance is the state shared by all the logical databases of the server.
+type Instance struct {
 	Replication *Replication
 	PubSub      *exchange.PubSub
-	mu          sync.Mutex
 	Role        string
-	RDBFileDir  string
-	RDBFileName string
-	List        *ListStore
+	Config      *config.Config
+
+	dbs []*DB // the logical databases, by number
+
+	// replMu keeps each propagated command together with the SELECT that
+	// may have to precede it.
+	replMu       sync.Mutex
+	replSelected int // database last selected on the replication stream, -1 for none
+
+	saving         atomic.Bool  // a SAVE or BGSAVE is writing the RDB file
+	lastSave       atomic.Int64 // unix time of the last successful save
+	lastSaveFailed atomic.Bool
+
+	hz atomic.Int64 // frequency of the active expire cycle
+
+	maxMemory    atomic.Int64 // bytes, 0 for no limit
+	policy       atomic.Int64 // an evictionPolicy
+	evictSamples atomic.Int64 // keys sampled per database for each eviction
+	evictMu      sync.Mutex   // serializes evictions and guards evictionPool
+	evictionPool []evictionCandidate
+	poolPolicy   evictionPolicy // the policy evictionPool was scored for
 }
 
-func New(role string) *DB {
-	return &DB{
-		Store:       &Store{Data: make(map[string]cacheValue), Streams: make(map[string][]StreamEntry)},
-		Replication: &Replication{ID: utils.GenerateReplicaID(), Offset: 0, Replicas: make([]*ReplicaConn, 0), NumAcksRecieved: 0},
-		PubSub:      exchange.NewPubSub(),
-		Role:        role,
-		List:        NewListStore(),
+// DB is one logical database, as selected by a connection with SELECT. The
+// databases of an instance share everything but their keyspace.
+type DB struct {
+	*Instance
+	Store *Store
+	ID    int
+
+	held         *heldLocks // set in a view that holds shard locks, see Lock
+	masterStream bool       // set in the view the replication stream is applied in
+}
+
+// New returns database 0 of a new instance with the given number of
+// databases.
+func New(role string, databases int) *DB {
+	inst := &Instance{
+		Replication:  &Replication{ID: utils.GenerateReplicaID(), Replicas: make([]*ReplicaConn, 0), NumAcksRecieved: 0},
+		PubSub:       exchange.NewPubSub(),
+		Role:         role,
+		replSelected: -1,
+	}
+	for id := range max(databases, 1) {
+		inst.dbs = append(inst.dbs, &DB{Instance: inst, Store: newStore(make(map[string]*Object)), ID: id})
 	}
+	return inst.dbs[0]
 }
 
+// Select returns database id of the same instance, seen the way db is: through
+// the same transaction and the same stream.
+func (db *DB) Select(id int) (*DB, error) {
+	if id < 0 || id >= len(db.dbs) {
+		return nil, resp.ErrDBIndex
+	}
+	return db.view(db.dbs[id]), nil
+}
+
+// Databases returns every database of the instance, by number, seen the way
+// db is.
+func (db *DB) Databases() []*DB {
+	if !db.isView() {
+		return db.dbs
+	}
+	dbs := make([]*DB, len(db.dbs))
+	for id, d := range db.dbs {
+		dbs[id] = db.view(d)
+	}
+	return dbs
+}
+
+// MasterStream returns a view of db for applying the replication stream.
+// The master decides when keys expire and sends a DEL when they do, so the
+// commands it sends see the keys it sent, even those whose expiry has
+// passed on this side, and compute the same results as on the master.
+func (db *DB) MasterStream() *DB {
+	view := *db
+	view.masterStream = true
+	return &view
+}
+
+// ReadOnly reports whether writes through db must be rejected: a replica
+// only takes those of its master, which come through MasterStream.
+func (db *DB) ReadOnly() bool {
+	return !db.IsMaster() && !db.masterStream
+}
+
+func (db *DB) isView() bool {
+	return db.held != nil || db.masterStream
+}
+
+// view returns d, a database of the same instance, seen the way db is.
+func (db *DB) view(d *DB) *DB {
+	if !db.isView() {
+		return d
+	}
+	view := *d
+	view.held, view.masterStream = db.held, db.masterStream
+	return &view
+}
 
 func (db *DB) ParseAndLoadRDBFile() error {
-	_, err := os.Stat(filepath.Join(db.RDBFileDir, db.RDBFileName))
+	dir, fileName := db.Config.Get("dir"), db.Config.Get("dbfilename")
+	_, err := os.Stat(filepath.Join(dir, fileName))
 	if os.IsNotExist(err) {
-		fmt.Println("RDB file not found, starting with empty database.")
+		logger.Notice("RDB file not found, starting with empty database", "path", filepath.Join(dir, fileName))
 		return nil
 	} else if err != nil {
 		return fmt.Errorf("error checking RDB file status: %w", err)
 	}
 
-	data, err := ParseRDBFile(db.RDBFileDir, db.RDBFileName)
+	dbs, err := ParseRDBFile(dir, fileName)
 	if err != nil {
 		return fmt.Errorf("failed to parse RDB file: %w", err)
 	}
+	for id := range dbs {
+		if id >= len(db.dbs) {
+			return fmt.Errorf("the RDB file has database %d, but only %d databases are configured", id, len(db.dbs))
+		}
+	}
 
-	db.Store.Mu.Lock()
-	defer db.Store.Mu.Unlock()
-	db.Store.Data = data
+	for id, data := range dbs {
+		d := db.dbs[id]
+		unlock := d.lockAll(true, d)
+		d.Store.reset(data)
+		unlock()
+	}
 	return nil
 }
 
 func (db *DB) UpdateOffset(length int) {
-	db.Replication.Offset = db.Replication.Offset + length
+	db.Replication.Offset.Add(int64(length))
 }
 
-func (db *DB) AddReplica(conn net.Conn) {
+// ResetStats clears the counters reported by INFO, as CONFIG RESETSTAT does.
+func (db *DB) ResetStats() {
+	atomic.StoreInt64(&db.Replication.OutputBufferDisconnects, 0)
+	stats.Reset()
+}
+
+// AddReplica starts propagating writes to conn through its output queue.
+func (db *DB) AddReplica(conn net.Conn, out *output.Queue) {
+	db.replMu.Lock()
+	defer db.replMu.Unlock()
 	db.Replication.ReplicaMu.Lock()
 	defer db.Replication.ReplicaMu.Unlock()
 
-	db.Replication.Replicas = append(db.Replication.Replicas, &ReplicaConn{Conn: conn})
-	fmt.Printf("Added replica connection. Total replicas: %d \n", len(db.Replication.Replicas))
+	// The new replica starts in database 0, whatever the others selected.
+	db.replSelected = -1
+
+	db.Replication.Replicas = append(db.Replication.Replicas, newReplicaConn(conn, out))
+	logger.Notice("Replica connected", "replica", conn.RemoteAddr().String(), "replicas", len(db.Replication.Replicas))
+}
+
+// ReplicaAck records a REPLCONF ACK received on conn, if it is a replica.
+func (db *DB) ReplicaAck(conn net.Conn, offset int64) {
+	db.Replication.ReplicaMu.RLock()
+	defer db.Replication.ReplicaMu.RUnlock()
+	for _, r := range db.Replication.Replicas {
+		if r.Conn == conn {
+			r.Ack(offset)
+			return
+		}
+	}
+}
+
+// ReplicasAcked returns how many replicas acknowledged offset or later.
+func (db *DB) ReplicasAcked(offset int64) int {
+	db.Replication.ReplicaMu.RLock()
+	defer db.Replication.ReplicaMu.RUnlock()
+	n := 0
+	for _, r := range db.Replication.Replicas {
+		if acked, _ := r.AckState(); acked >= offset {
+			n++
+		}
+	}
+	return n
 }
 
 func (db *DB) RemoveReplica(conn net.Conn) {
@@ -73,94 +210,186 @@ func (db *DB) RemoveReplica(conn net.Conn) {
 	defer db.Replication.ReplicaMu.Unlock()
 	for i, r := range db.Replication.Replicas {
 		if r.Conn == conn {
-			fmt.Printf("Removing replica connection from address: %s\n", conn.RemoteAddr().String())
-			_ = r.Conn.Close()
+			logger.Notice("Connection with replica lost", "replica", conn.RemoteAddr().String())
+			r.Close()
 			db.Replication.Replicas = append(db.Replication.Replicas[:i], db.Replication.Replicas[i+1:]...)
 			break
 		}
 	}
 }
 
-// PropagateCommand now locks per-replica before writing
-func (db *DB) PropagateCommand(args []string) {
+// PropagateCommand queues an encoded command on every replica's output
+// buffer. Replicas that overcome their output buffer limit are disconnected.
+func (db *DB) PropagateCommand(respCmd []byte) {
 	db.Replication.ReplicaMu.RLock()
 	defer db.Replication.ReplicaMu.RUnlock()
 
-	respCmd := utils.FormatRESPArray(args)
-
 	for _, r := range db.Replication.Replicas {
-		r.Mu.Lock()
-		_, err := r.Conn.Write([]byte(respCmd))
-		r.Mu.Unlock()
-		if err != nil {
-			fmt.Printf("Failed to propagate command to replica: %v\n", err)
-			// Note: we don't remove here; removal happens in other code paths (or optionally add removal logic)
-			continue
+		if errors.Is(r.Enqueue(respCmd), ErrOutputBufferLimit) {
+			atomic.AddInt64(&db.Replication.OutputBufferDisconnects, 1)
 		}
 	}
 }
 
-func (db *DB) GetLastID(key string) string {
-	db.Store.Mu.RLock()
-	defer db.Store.Mu.RUnlock()
+// KeyspaceStats returns the number of keys, how many of them have an expiry
+// and their average remaining time to live in milliseconds, for INFO
+// keyspace.
+func (db *DB) KeyspaceStats() (keys, expires, avgTTL int64) {
+	now := time.Now().UnixMilli()
+	var totalTTL int64
+
+	for i := range shardCount {
+		sh, unlock := db.lockShard(i, false)
+		keys += int64(len(sh.Data))
+		for _, obj := range sh.Data {
+			if obj.ExpireAt > 0 {
+				expires++
+				if obj.ExpireAt > now {
+					totalTTL += obj.ExpireAt - now
+				}
+			}
+		}
+		unlock()
+	}
 
-	if stream, ok := db.Store.Streams[key]; ok && len(stream) > 0 {
-		return stream[len(stream)-1].ID
+	if expires > 0 {
+		avgTTL = totalTTL / expires
 	}
-	return "0-0"
+	return keys, expires, avgTTL
 }
 
-func (db *DB) Get(key string) (string, bool) {
-	db.Store.Mu.RLock()
-	defer db.Store.Mu.RUnlock()
+// KeysByType returns the number of keys holding each type of value.
+func (db *DB) KeysByType() map[string]int64 {
+	counts := map[string]int64{TypeString: 0, TypeList: 0, TypeStream: 0}
 
-	val, ok := db.Store.Data[key]
-	if !ok {
-		return "", false
+	for i := range shardCount {
+		sh, unlock := db.lockShard(i, false)
+		for _, obj := range sh.Data {
+			counts[obj.Type()]++
+		}
+		unlock()
 	}
+	return counts
+}
 
-	if val.Ttl > 0 && time.Now().UnixMilli() > val.Ttl {
+// Get returns the string stored at key. Expired keys are reported as missing;
+// on a master they are also deleted and the deletion is propagated.
+func (db *DB) Get(key string) (string, bool, error) {
+	db.expireIfNeeded(key)
 
-		delete(db.Store.Data, key)
-		return "", false
+	defer db.rlock(key)()
+	obj, err := db.lookupRead(key, TypeString)
+	if obj == nil {
+		return "", false, err
 	}
-	return val.Value, true
+	return obj.Value.(string), true, nil
 }
 
+// MGet returns the strings stored at keys, all read at the same instant.
+// found[i] is false where MGET replies nil: the key is missing or holds
+// another type.
+func (db *DB) MGet(keys []string) (values []string, found []bool) {
+	for _, key := range keys {
+		db.expireIfNeeded(key)
+	}
+
+	defer db.rlock(keys...)()
+	values, found = make([]string, len(keys)), make([]bool, len(keys))
+	for i, key := range keys {
+		if obj, _ := db.lookupRead(key, TypeString); obj != nil {
+			values[i], found[i] = obj.Value.(string), true
+		}
+	}
+	return values, found
+}
+
+// GetType returns the type of the value at key, or "none".
 func (db *DB) GetType(key string) string {
-	db.Store.Mu.RLock()
-	defer db.Store.Mu.RUnlock()
+	db.expireIfNeeded(key)
 
-	if _, ok := db.Store.Data[key]; ok {
-		return "string"
+	defer db.rlock(key)()
+	obj, _ := db.peek(key, "")
+	if obj == nil {
+		return "none"
 	}
-	if _, ok := db.Store.Streams[key]; ok {
-		return "stream"
+	return obj.Type()
+}
+
+// Set stores a string, replacing whatever value key held. expireAtMs is an
+// absolute unix time in milliseconds, or 0 for no expiry.
+func (db *DB) Set(key, Value string, expireAtMs int64) {
+	defer db.lock(key)()
+	db.Store.put(key, &Object{Value: Value, ExpireAt: expireAtMs})
+}
+
+// Del removes keys of any type and returns how many existed. Logically
+// expired keys are not counted: a master expires them first, which
+// propagates their own DEL, and a replica removes them all the same.
+func (db *DB) Del(keys ...string) int {
+	for _, key := range keys {
+		db.expireIfNeeded(key)
 	}
-	return "none"
+	now := time.Now().UnixMilli()
+	deleted := 0
+
+	defer db.lock(keys...)()
+	for _, key := range keys {
+		if obj, ok := db.Store.get(key); ok {
+			db.Store.remove(key)
+			if !obj.expired(now) {
+				deleted++
+			}
+		}
+	}
+	return deleted
 }
-func (db *DB) Set(key, Value string, ttlMilSec int64) {
-	db.Store.Mu.Lock()
-	defer db.Store.Mu.Unlock()
 
-	var Ttl int64
-	if ttlMilSec > 0 {
-		Ttl = time.Now().UnixMilli() + ttlMilSec
+// Keys returns every key that is not logically expired.
+func (db *DB) Keys() []string {
+	now := time.Now().UnixMilli()
+	keys := []string{}
+	for i := range shardCount {
+		sh, unlock := db.lockShard(i, false)
+		for key, obj := range sh.Data {
+			if !obj.expired(now) {
+				keys = append(keys, key)
+			}
+		}
+		unlock()
 	}
-	db.Store.Data[key] = cacheValue{Value: Value, Ttl: Ttl}
+	return keys
 }
 
-func (db *DB) XAdd(key, ID string, fields map[string]string) (string, error) {
-	db.Store.Mu.Lock()
-	defer db.Store.Mu.Unlock()
+// GetLastID returns the ID of the last entry of the stream at key, or "0-0".
+func (db *DB) GetLastID(key string) string {
+	db.expireIfNeeded(key)
 
-	if _, ok := db.Store.Data[key]; ok {
-		return "", fmt.Errorf("wrong key type")
+	defer db.rlock(key)()
+	obj, _ := db.lookup(key, TypeStream)
+	if obj == nil {
+		return "0-0"
+	}
+	if stream := obj.Value.([]StreamEntry); len(stream) > 0 {
+		return stream[len(stream)-1].ID
 	}
+	return "0-0"
+}
 
+func (db *DB) XAdd(key, ID string, fields map[string]string) (string, error) {
+	db.expireIfNeeded(key)
+
+	defer db.lock(key)()
+	obj, err := db.lookup(key, TypeStream)
+	if err != nil {
+		return "", err
+	}
+	var stream []StreamEntry
 	lastID := ""
-	if stream, streamExists := db.Store.Streams[key]; streamExists && len(stream) > 0 {
-		lastID = stream[len(stream)-1].ID
+	if obj != nil {
+		stream = obj.Value.([]StreamEntry)
+		if len(stream) > 0 {
+			lastID = stream[len(stream)-1].ID
+		}
 	}
 
 	finalID, err := utils.ValidateStreamID(ID, lastID)
@@ -173,14 +402,32 @@ func (db *DB) XAdd(key, ID string, fields map[string]string) (string, error) {
 		Fields: fields,
 	}
 
-	db.Store.Streams[key] = append(db.Store.Streams[key], entry)
+	if obj == nil {
+		obj = &Object{Value: []StreamEntry(nil)}
+		db.Store.put(key, obj)
+	}
+	obj.Value = append(stream, entry)
+	db.Store.grow(obj, streamEntrySize(entry))
 	return finalID, nil
 }
 
-func (db *DB) XRange(key, start, end string) []StreamEntry {
-	entries, ok := db.Store.Streams[key]
-	if !ok {
-		return nil
+// stream returns the entries of the stream at key. Entries are only ever
+// appended, so the slice can be read after the lock is released.
+func (db *DB) stream(key string) ([]StreamEntry, error) {
+	db.expireIfNeeded(key)
+
+	defer db.rlock(key)()
+	obj, err := db.lookupRead(key, TypeStream)
+	if obj == nil {
+		return nil, err
+	}
+	return obj.Value.([]StreamEntry), nil
+}
+
+func (db *DB) XRange(key, start, end string) ([]StreamEntry, error) {
+	entries, err := db.stream(key)
+	if entries == nil {
+		return nil, err
 	}
 
 	startMs, startSeq := utils.ParsID(start) // (if start == "-"") strings.split will split it into 0,0
@@ -201,13 +448,13 @@ func (db *DB) XRange(key, start, end string) []StreamEntry {
 		}
 	}
 
-	return wantedEntries
+	return wantedEntries, nil
 }
 
-func (db *DB) XREAD(key, ID string) []StreamEntry {
-	entries, ok := db.Store.Streams[key]
-	if !ok {
-		return nil
+func (db *DB) XREAD(key, ID string) ([]StreamEntry, error) {
+	entries, err := db.stream(key)
+	if entries == nil {
+		return nil, err
 	}
 	IDMs, IDSeq := utils.ParsID(ID)
 	var wantedEntries []StreamEntry
@@ -219,24 +466,34 @@ func (db *DB) XREAD(key, ID string) []StreamEntry {
 		}
 	}
 
-	return wantedEntries
+	return wantedEntries, nil
 }
 
-func (db *DB) INCR(key string) int64 {
-	db.Store.Mu.Lock()
-	defer db.Store.Mu.Unlock()
+// INCR increments the integer stored at key, creating it at 0 first.
+func (db *DB) INCR(key string) (int64, error) {
+	// Writes on a master must not see an expired value, so drop it first.
+	// Replicas apply the master's stream as-is: it already carries the DEL.
+	db.expireIfNeeded(key)
 
-	val, ok := db.Store.Data[key]
-	if !ok {
-		db.Store.Data[key] = cacheValue{Value: "1", Ttl: 0}
-		return int64(1)
+	defer db.lock(key)()
+	obj, err := db.lookup(key, TypeString)
+	if err != nil {
+		return 0, err
+	}
+	if obj == nil {
+		db.Store.put(key, &Object{Value: "1"})
+		return 1, nil
 	}
 
-	intVal, err := strconv.ParseInt(val.Value, 10, 64)
+	intVal, err := strconv.ParseInt(obj.Value.(string), 10, 64)
 	if err != nil {
-		return -1
+		return 0, resp.ErrNotInteger
+	}
+	if intVal == math.MaxInt64 {
+		return 0, resp.ErrOverflow
 	}
-	val.Value = strconv.Itoa(int(intVal + 1))
-	db.Store.Data[key] = val
-	return intVal + 1
+	value := strconv.FormatInt(intVal+1, 10)
+	db.Store.grow(obj, int64(len(value)-len(obj.Value.(string))))
+	obj.Value = value
+	return intVal + 1, nil
 }
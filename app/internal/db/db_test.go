@@ -0,0 +1,55 @@
+package db
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// BenchmarkParallel runs GET and SET from every P at once, across many keys
+// and thus every shard, and on a single hot key, whose one shard lock all
+// goroutines contend on. Run with -cpu 1,2,4,8 to see how each scales.
+func BenchmarkParallel(b *testing.B) {
+	const numKeys = 1 << 14
+	keys := make([]string, numKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("key:%d", i)
+	}
+
+	for _, bm := range []struct {
+		name   string
+		keys   []string
+		writes int // SETs per 10 commands
+	}{
+		{"GET", keys, 0},
+		{"SET", keys, 10},
+		{"GET90SET10", keys, 1},
+		{"GET/hot", keys[:1], 0},
+		{"SET/hot", keys[:1], 10},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			db := New("master", 16)
+			for _, key := range bm.keys {
+				db.Set(key, "value", 0)
+			}
+			// Each goroutine walks the keys from its own offset so they do
+			// not move over the shards in lockstep.
+			var goroutines atomic.Int64
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(goroutines.Add(1)) * 7919
+				for pb.Next() {
+					key := bm.keys[i%len(bm.keys)]
+					if i%10 < bm.writes {
+						db.Set(key, "value", 0)
+					} else if _, ok, _ := db.Get(key); !ok {
+						b.Error("missing key", key)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package db
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+)
+
+// Eviction, after Redis' evict.c: when the keys take more than maxmemory, the
+// master samples maxmemory-samples keys from every database, keeps the best
+// candidates for the policy in a small pool that outlives each call, and
+// deletes the best one until usage is back under the limit. Like expired
+// keys, evicted keys reach replicas as an explicit DEL; replicas never evict
+// on their own.
+
+type evictionPolicy int64
+
+const (
+	policyNoEviction evictionPolicy = iota
+	policyAllKeysLRU
+	policyVolatileLRU
+	policyAllKeysLFU
+	policyVolatileLFU
+	policyAllKeysRandom
+	policyVolatileRandom
+	policyVolatileTTL
+)
+
+// EvictionPolicies are the values of maxmemory-policy.
+var EvictionPolicies = []string{
+	"noeviction",
+	"allkeys-lru",
+	"volatile-lru",
+	"allkeys-lfu",
+	"volatile-lfu",
+	"allkeys-random",
+	"volatile-random",
+	"volatile-ttl",
+}
+
+func (p evictionPolicy) volatile() bool {
+	switch p {
+	case policyVolatileLRU, policyVolatileLFU, policyVolatileRandom, policyVolatileTTL:
+		return true
+	}
+	return false
+}
+
+func (p evictionPolicy) lru() bool {
+	return p == policyAllKeysLRU || p == policyVolatileLRU
+}
+
+func (p evictionPolicy) lfu() bool {
+	return p == policyAllKeysLFU || p == policyVolatileLFU
+}
+
+// evictionPoolSize is how many candidates are kept between evictions, as
+// Redis' EVPOOL_SIZE.
+const evictionPoolSize = 16
+
+type evictionCandidate struct {
+	db    *DB
+	key   string
+	obj   *Object
+	score int64 // higher is evicted first
+}
+
+// SetMaxMemory sets maxmemory, in bytes.
+func (db *DB) SetMaxMemory(bytes int64) {
+	db.maxMemory.Store(bytes)
+}
+
+// MaxMemory returns maxmemory, in bytes.
+func (db *DB) MaxMemory() int64 {
+	return db.maxMemory.Load()
+}
+
+// SetEvictionPolicy sets maxmemory-policy, one of EvictionPolicies. It does
+// not wait for an eviction in progress: CONFIG SET may run inside EXEC with
+// shards locked that the eviction needs. The next eviction drops the pool
+// instead.
+func (db *DB) SetEvictionPolicy(name string) {
+	db.policy.Store(int64(slices.Index(EvictionPolicies, name)))
+}
+
+// EvictionPolicy returns maxmemory-policy.
+func (db *DB) EvictionPolicy() string {
+	return EvictionPolicies[db.policy.Load()]
+}
+
+// SetEvictionSamples sets maxmemory-samples.
+func (db *DB) SetEvictionSamples(n int64) {
+	db.evictSamples.Store(n)
+}
+
+// UsedMemory returns the estimated memory taken by the keys of every
+// database, which is what maxmemory limits.
+func (db *DB) UsedMemory() int64 {
+	var used int64
+	for _, d := range db.dbs {
+		used += d.Store.Used()
+	}
+	return used
+}
+
+// EnforceMaxMemory evicts keys until the keys fit in maxmemory. It returns
+// resp.ErrOOM if they still do not, because the policy is noeviction or
+// there is nothing left that the policy may evict. Commands that could use
+// more memory are refused on that error.
+func (db *DB) EnforceMaxMemory() error {
+	limit := db.maxMemory.Load()
+	if limit == 0 || !db.IsMaster() || db.UsedMemory() <= limit {
+		return nil
+	}
+
+	db.evictMu.Lock()
+	defer db.evictMu.Unlock()
+	policy := evictionPolicy(db.policy.Load())
+	if policy == policyNoEviction {
+		return resp.ErrOOM
+	}
+	if policy != db.poolPolicy {
+		// Scores of different policies cannot be compared.
+		db.evictionPool = nil
+		db.poolPolicy = policy
+	}
+	for db.UsedMemory() > limit {
+		victim, ok := db.nextVictim(policy)
+		if !ok {
+			return resp.ErrOOM
+		}
+		victim.db.evict(victim.key, victim.obj)
+	}
+	return nil
+}
+
+// nextVictim refills the pool from every database and takes its best
+// candidate. It reports false if no database has a key the policy may
+// evict. Callers must hold evictMu.
+func (db *DB) nextVictim(policy evictionPolicy) (evictionCandidate, bool) {
+	for _, d := range db.dbs {
+		d.sampleCandidates(policy, int(db.evictSamples.Load()))
+	}
+	if len(db.evictionPool) == 0 {
+		return evictionCandidate{}, false
+	}
+	last := len(db.evictionPool) - 1
+	victim := db.evictionPool[last]
+	db.evictionPool = db.evictionPool[:last]
+	return victim, true
+}
+
+// sampleCandidates adds up to n keys of db to the eviction pool of the
+// instance, taken from the shards in turn from a random one. Callers must
+// hold evictMu.
+func (db *DB) sampleCandidates(policy evictionPolicy, n int) {
+	now := time.Now().UnixMilli()
+	sampled := 0
+	first := rand.IntN(shardCount)
+	for i := 0; i < shardCount && sampled < n; i++ {
+		sh, unlock := db.lockShard((first+i)%shardCount, false)
+		sampled += db.sampleShard(sh, policy, n-sampled, now)
+		unlock()
+	}
+}
+
+// sampleShard offers up to n keys of sh to the eviction pool and returns how
+// many it offered. Callers must hold the lock of sh.
+func (db *DB) sampleShard(sh *shard, policy evictionPolicy, n int, now int64) int {
+	sampled, visited := 0, 0
+	consider := func(key string, obj *Object) bool {
+		db.offerCandidate(evictionCandidate{db: db, key: key, obj: obj, score: obj.evictionScore(policy, now)})
+		sampled++
+		return sampled < n
+	}
+	// Map iteration starts at a random position, which makes these samples.
+	if policy.volatile() {
+		for key := range sh.expires {
+			// The index may still hold keys whose expiry was removed;
+			// expireSample drops them, this only reads.
+			if visited++; visited > n*10 {
+				break
+			}
+			if obj, ok := sh.Data[key]; ok && obj.ExpireAt != 0 && !consider(key, obj) {
+				break
+			}
+		}
+		return sampled
+	}
+	for key, obj := range sh.Data {
+		if !consider(key, obj) {
+			break
+		}
+	}
+	return sampled
+}
+
+// offerCandidate inserts c into the pool, which is kept sorted by score,
+// unless the pool is full of better candidates. A key already in the pool
+// only has its score updated.
+func (db *DB) offerCandidate(c evictionCandidate) {
+	pool := db.evictionPool
+	if i := slices.IndexFunc(pool, func(e evictionCandidate) bool { return e.db == c.db && e.key == c.key }); i >= 0 {
+		pool = slices.Delete(pool, i, i+1)
+	}
+	i, _ := slices.BinarySearchFunc(pool, c.score, func(e evictionCandidate, score int64) int {
+		return cmp.Compare(e.score, score)
+	})
+	if len(pool) == evictionPoolSize {
+		if i == 0 {
+			return
+		}
+		pool = pool[1:]
+		i--
+	}
+	db.evictionPool = slices.Insert(pool, i, c)
+}
+
+// evictionScore ranks o for policy; the highest score is evicted first.
+func (o *Object) evictionScore(policy evictionPolicy, nowMs int64) int64 {
+	switch policy {
+	case policyAllKeysLRU, policyVolatileLRU:
+		return nowMs - o.accessed.Load()
+	case policyAllKeysLFU, policyVolatileLFU:
+		return lfuMax - o.lfuDecay(nowMs)
+	case policyVolatileTTL:
+		return math.MaxInt64 - o.ExpireAt
+	}
+	return rand.Int64()
+}
+
+// evict deletes key if it still holds obj, which the pool may have
+// outlived, and propagates the deletion before unlocking the key's shard.
+func (db *DB) evict(key string, obj *Object) {
+	defer db.lock(key)()
+	if current, _ := db.Store.get(key); current != obj {
+		return
+	}
+	db.Store.remove(key)
+	stats.EvictedKeys.Add(1)
+	db.Propagate([]string{"DEL", key})
+}
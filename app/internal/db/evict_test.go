@@ -0,0 +1,142 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+)
+
+// evictionKey is a key of the eviction tests, with what each policy looks at.
+type evictionKey struct {
+	name     string
+	db       int
+	expireIn time.Duration // 0 for no expiry
+	idle     time.Duration
+	freq     int64
+}
+
+// Each policy has its own best candidate among these keys.
+var evictionKeys = []evictionKey{
+	{"recent", 0, 0, 0, 10},
+	{"old", 0, 0, time.Hour, 5},                             // allkeys-lru
+	{"rare", 0, 0, 0, 0},                                    // allkeys-lfu
+	{"volatile-old", 0, 2 * time.Hour, 10 * time.Minute, 5}, // volatile-lru
+	{"volatile-rare", 0, 3 * time.Hour, 0, 1},               // volatile-lfu
+	{"soon", 1, time.Minute, 0, 5},                          // volatile-ttl, in another database
+}
+
+// newEvictionDB stores keys in a master whose maxmemory is one byte short
+// of what they take, so that evicting any one of them is enough.
+func newEvictionDB(t *testing.T, policy string, keys []evictionKey) *DB {
+	t.Helper()
+	db := New("master", 2)
+	now := time.Now()
+	for _, k := range keys {
+		d, _ := db.Select(k.db)
+		var expireAt int64
+		if k.expireIn != 0 {
+			expireAt = now.Add(k.expireIn).UnixMilli()
+		}
+		d.Set(k.name, "value", expireAt)
+		obj, _ := d.Store.get(k.name)
+		obj.accessed.Store(now.Add(-k.idle).UnixMilli())
+		obj.freq.Store(k.freq)
+	}
+	db.SetEvictionPolicy(policy)
+	// Sample every key, so that the best candidate is always found.
+	db.SetEvictionSamples(100)
+	db.SetMaxMemory(db.UsedMemory() - 1)
+	return db
+}
+
+// evicted returns the keys of every database of db that are not in keys.
+func evicted(db *DB, keys []evictionKey) []string {
+	var gone []string
+	for _, k := range keys {
+		d, _ := db.Select(k.db)
+		if d.Exists(k.name) == 0 {
+			gone = append(gone, k.name)
+		}
+	}
+	return gone
+}
+
+func TestEvictionPolicies(t *testing.T) {
+	// Keep the LFU counters of idle keys from decaying.
+	SetLFUDecayTime(0)
+	t.Cleanup(func() { SetLFUDecayTime(1) })
+
+	volatile := []string{"volatile-old", "volatile-rare", "soon"}
+	all := append([]string{"recent", "old", "rare"}, volatile...)
+	tests := []struct {
+		policy string
+		oom    bool
+		want   []string // any one of these is evicted
+	}{
+		{"noeviction", true, nil},
+		{"allkeys-lru", false, []string{"old"}},
+		{"volatile-lru", false, []string{"volatile-old"}},
+		{"allkeys-lfu", false, []string{"rare"}},
+		{"volatile-lfu", false, []string{"volatile-rare"}},
+		{"allkeys-random", false, all},
+		{"volatile-random", false, volatile},
+		{"volatile-ttl", false, []string{"soon"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			db := newEvictionDB(t, tt.policy, evictionKeys)
+			before := stats.EvictedKeys.Load()
+			err := db.EnforceMaxMemory()
+			if tt.oom {
+				if !errors.Is(err, resp.ErrOOM) {
+					t.Fatalf("EnforceMaxMemory() = %v, want OOM", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			gone := evicted(db, evictionKeys)
+			if tt.oom {
+				if len(gone) != 0 {
+					t.Errorf("evicted %q", gone)
+				}
+			} else if len(gone) != 1 || !slices.Contains(tt.want, gone[0]) {
+				t.Errorf("evicted %q, want one of %q", gone, tt.want)
+			}
+			if n := stats.EvictedKeys.Load() - before; n != int64(len(gone)) {
+				t.Errorf("evicted_keys grew by %d, want %d", n, len(gone))
+			}
+		})
+	}
+}
+
+// The volatile policies never evict a key without an expiry, and reply OOM
+// once there is nothing else.
+func TestEvictionVolatileWithoutExpires(t *testing.T) {
+	keys := []evictionKey{{"a", 0, 0, time.Hour, 0}, {"b", 1, 0, 0, 0}}
+	for _, policy := range []string{"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl"} {
+		db := newEvictionDB(t, policy, keys)
+		if err := db.EnforceMaxMemory(); !errors.Is(err, resp.ErrOOM) {
+			t.Errorf("%s: EnforceMaxMemory() = %v, want OOM", policy, err)
+		}
+		if gone := evicted(db, keys); len(gone) != 0 {
+			t.Errorf("%s evicted %q", policy, gone)
+		}
+	}
+}
+
+// Under the limit, nothing is evicted whatever the policy.
+func TestEvictionUnderLimit(t *testing.T) {
+	db := newEvictionDB(t, "allkeys-random", evictionKeys)
+	db.SetMaxMemory(db.UsedMemory())
+	if err := db.EnforceMaxMemory(); err != nil {
+		t.Fatal(err)
+	}
+	if gone := evicted(db, evictionKeys); len(gone) != 0 {
+		t.Errorf("evicted %q", gone)
+	}
+}
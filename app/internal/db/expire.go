@@ -0,0 +1,275 @@
+package db
+
+import (
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
+)
+
+// Expiry follows Redis' master/replica split: only the master deletes expired
+// keys, and it tells replicas about it with an explicit DEL. A replica keeps
+// logically expired keys in memory (reads treat them as missing) until that
+// DEL arrives, so both sides always agree on the keyspace.
+
+// IsMaster reports whether this instance is responsible for expiring keys.
+func (db *DB) IsMaster() bool {
+	return db.Role == "master"
+}
+
+// Propagate sends a write command to the replicas and advances the
+// replication offset, preceded by a SELECT if the replicas last applied a
+// command to another database. It is a no-op on replicas.
+func (db *DB) Propagate(args []string) {
+	if !db.IsMaster() {
+		return
+	}
+	db.replMu.Lock()
+	defer db.replMu.Unlock()
+	if db.replSelected != db.ID {
+		db.propagate([]string{"SELECT", strconv.Itoa(db.ID)})
+		db.replSelected = db.ID
+	}
+	db.propagate(args)
+}
+
+func (db *DB) propagate(args []string) {
+	command := []byte(utils.FormatRESPArray(args))
+	db.PropagateCommand(command)
+	db.UpdateOffset(len(command))
+}
+
+// expireIfNeeded deletes key on a master if it has expired, and propagates
+// the deletion. Every command touching a key calls it before locking the
+// key's shard, so the commands themselves only ever see live keys on a
+// master. The DEL is propagated before the shard is unlocked, so that a
+// write to the key that follows it cannot reach the replicas first. Callers
+// must not hold the lock, unless through a transaction.
+func (db *DB) expireIfNeeded(key string) {
+	if !db.IsMaster() {
+		return
+	}
+	defer db.lock(key)()
+	obj, ok := db.Store.get(key)
+	if !ok || !obj.expired(time.Now().UnixMilli()) {
+		return
+	}
+	db.Store.remove(key)
+	stats.ExpiredKeys.Add(1)
+	db.Propagate([]string{"DEL", key})
+}
+
+// lookup returns the live object at key, or nil if there is none, and
+// records the access for eviction. Expired keys a replica still holds are
+// reported as missing, except to the master's stream. If want is not empty
+// and the key holds another type, resp.ErrWrongType is returned. Callers
+// must hold the lock of the key's shard.
+func (db *DB) lookup(key, want string) (*Object, error) {
+	obj, err := db.peek(key, want)
+	if obj != nil {
+		obj.touch()
+	}
+	return obj, err
+}
+
+// peek is lookup without recording an access, for commands such as TYPE
+// and TTL that only look at the key from the outside.
+func (db *DB) peek(key, want string) (*Object, error) {
+	obj, ok := db.Store.get(key)
+	if !ok || (!db.masterStream && obj.expired(time.Now().UnixMilli())) {
+		return nil, nil
+	}
+	if want != "" && obj.Type() != want {
+		return nil, resp.ErrWrongType
+	}
+	return obj, nil
+}
+
+// lookupRead is lookup for commands that read the key, which are the ones
+// counted in keyspace_hits and keyspace_misses.
+func (db *DB) lookupRead(key, want string) (*Object, error) {
+	obj, err := db.lookup(key, want)
+	if obj != nil {
+		stats.KeyspaceHits.Add(1)
+	} else if err == nil {
+		stats.KeyspaceMisses.Add(1)
+	}
+	return obj, err
+}
+
+// Expire sets the expiry of key to atMs, an absolute unix time in
+// milliseconds. condition is "", "NX", "XX", "GT" or "LT", with Redis'
+// meaning: a key without expiry counts as expiring infinitely late for GT
+// and LT. It returns whether the expiry was set. A master deletes the key
+// right away if atMs has already passed, propagates the DEL before unlocking
+// the key's shard, as expireIfNeeded does, and reports it with deleted.
+func (db *DB) Expire(key string, atMs int64, condition string) (set, deleted bool) {
+	db.expireIfNeeded(key)
+
+	defer db.lock(key)()
+	obj, _ := db.lookup(key, "")
+	if obj == nil {
+		return false, false
+	}
+
+	switch condition {
+	case "NX":
+		set = obj.ExpireAt == 0
+	case "XX":
+		set = obj.ExpireAt != 0
+	case "GT":
+		set = obj.ExpireAt != 0 && atMs > obj.ExpireAt
+	case "LT":
+		set = obj.ExpireAt == 0 || atMs < obj.ExpireAt
+	default:
+		set = true
+	}
+	if !set {
+		return false, false
+	}
+
+	if atMs <= time.Now().UnixMilli() && db.IsMaster() {
+		db.Store.remove(key)
+		db.Propagate([]string{"DEL", key})
+		return true, true
+	}
+	obj.ExpireAt = atMs
+	db.Store.trackExpire(key, obj)
+	return true, false
+}
+
+// ExpireTime returns the absolute expiry of key in unix milliseconds, -1 if
+// it has none and -2 if the key does not exist.
+func (db *DB) ExpireTime(key string) int64 {
+	db.expireIfNeeded(key)
+
+	defer db.rlock(key)()
+	obj, _ := db.peek(key, "")
+	if obj == nil {
+		return -2
+	}
+	if obj.ExpireAt == 0 {
+		return -1
+	}
+	return obj.ExpireAt
+}
+
+// Persist removes the expiry of key and reports whether it had one.
+func (db *DB) Persist(key string) bool {
+	db.expireIfNeeded(key)
+
+	defer db.lock(key)()
+	obj, _ := db.lookup(key, "")
+	if obj == nil || obj.ExpireAt == 0 {
+		return false
+	}
+	obj.ExpireAt = 0
+	return true
+}
+
+// Active expiry, after Redis' activeExpireCycle: hz times a second the master
+// samples keys from the expires index and deletes the expired ones. While
+// more than expireAcceptableStale percent of a sample was expired it samples
+// again, within expireCycleBudget of the cycle period, so a burst of expired
+// keys is reclaimed quickly without stalling clients.
+const (
+	expireKeysPerLoop     = 20
+	expireAcceptableStale = 10 // percent
+	expireCycleBudget     = 25 // percent of 1/hz
+)
+
+// SetHz sets how many times a second the active expire cycle runs.
+func (db *DB) SetHz(hz int64) {
+	db.hz.Store(hz)
+}
+
+// Hz returns the frequency of the active expire cycle.
+func (db *DB) Hz() int64 {
+	return db.hz.Load()
+}
+
+// StartActiveExpire runs the active expire cycle over every database until
+// the process exits. Replicas skip it and wait for the master's DEL, as with
+// lazy expiry.
+func (db *DB) StartActiveExpire() {
+	go func() {
+		// Each cycle starts where the previous one ran out of time, so
+		// that the later databases are not starved.
+		next := 0
+		for {
+			period := time.Second / time.Duration(max(db.hz.Load(), 1))
+			time.Sleep(period)
+			if !db.IsMaster() {
+				continue
+			}
+			start, budget := time.Now(), period*expireCycleBudget/100
+			for range db.dbs {
+				remaining := budget - time.Since(start)
+				if remaining <= 0 {
+					break
+				}
+				db.dbs[next].activeExpireCycle(remaining)
+				next = (next + 1) % len(db.dbs)
+			}
+		}
+	}()
+}
+
+// activeExpireCycle deletes expired keys until a sample is mostly live keys
+// or budget is spent, and returns how many keys it deleted.
+func (db *DB) activeExpireCycle(budget time.Duration) int {
+	start := time.Now()
+	total := 0
+	for {
+		sampled, expired := db.expireSample()
+		total += expired
+		if sampled == 0 || expired*100 <= sampled*expireAcceptableStale || time.Since(start) > budget {
+			return total
+		}
+	}
+}
+
+// expireSample checks up to expireKeysPerLoop keys of the expires indexes
+// and deletes and propagates the expired ones, going through the shards
+// from a random one and locking one at a time. It returns how many keys
+// with an expiry it looked at and how many it deleted.
+func (db *DB) expireSample() (sampled, expired int) {
+	now := time.Now().UnixMilli()
+	first := rand.IntN(shardCount)
+	for n := range shardCount {
+		if sampled == expireKeysPerLoop {
+			break
+		}
+		sh, unlock := db.lockShard((first+n)%shardCount, true)
+		visited := 0
+		// Map iteration starts at a random position, which makes this a
+		// sample.
+		for key := range sh.expires {
+			// Stale entries are cheap to drop but still bound how long
+			// the lock is held.
+			if sampled == expireKeysPerLoop || visited == expireKeysPerLoop*10 {
+				break
+			}
+			visited++
+			obj, ok := sh.Data[key]
+			if !ok || obj.ExpireAt == 0 {
+				delete(sh.expires, key)
+				continue
+			}
+			sampled++
+			if obj.expired(now) {
+				db.Store.remove(key)
+				delete(sh.expires, key)
+				// Under the lock, as in expireIfNeeded.
+				db.Propagate([]string{"DEL", key})
+				expired++
+			}
+		}
+		unlock()
+	}
+	stats.ExpiredKeys.Add(int64(expired))
+	return sampled, expired
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/output"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+)
+
+// A replica keeps expired keys until the master's DEL arrives. Its clients
+// must not see them, but the commands of the master must, or they compute
+// something else than the master did.
+func TestReplicaMasterStreamSeesExpiredKeys(t *testing.T) {
+	replica := New("slave", 16)
+	past := time.Now().Add(-time.Second).UnixMilli()
+	replica.Set("counter", "5", past)
+	replica.Set("gone", "x", past)
+
+	if _, ok, _ := replica.Get("counter"); ok {
+		t.Fatal("a client of the replica sees an expired key")
+	}
+
+	stream := replica.MasterStream()
+	n, err := stream.INCR("counter")
+	if err != nil || n != 6 {
+		t.Fatalf("INCR from the master = %d, %v; want 6", n, err)
+	}
+	if n := stream.Exists("gone"); n != 1 {
+		t.Fatalf("EXISTS from the master = %d; want 1", n)
+	}
+
+	selected, err := stream.Select(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected.Set("other", "x", past)
+	if n := selected.Exists("other"); n != 1 {
+		t.Fatal("SELECT on the master stream lost the view")
+	}
+	if n := replica.Exists("gone"); n != 0 {
+		t.Fatal("the master stream view leaked into the database")
+	}
+}
+
+// An expiry in the past deletes the key on a master, which tells its
+// replicas with a DEL.
+func TestExpireInThePastPropagatesDel(t *testing.T) {
+	master := New("master", 16)
+	server, client := net.Pipe()
+	defer client.Close()
+	master.AddReplica(server, output.New(server))
+	master.Set("k", "v", 0)
+
+	if set, deleted := master.Expire("k", time.Now().Add(-time.Second).UnixMilli(), ""); !set || !deleted {
+		t.Fatalf("Expire = %v, %v; want true, true", set, deleted)
+	}
+	if master.Exists("k") != 0 {
+		t.Fatal("the key is still there")
+	}
+	r := resp.NewReader(client)
+	for _, want := range [][]string{{"SELECT", "0"}, {"DEL", "k"}} {
+		got, err := r.ReadCommand()
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("propagated %q, %v; want %q", got, err, want)
+		}
+	}
+}
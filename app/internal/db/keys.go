@@ -0,0 +1,223 @@
+package db
+
+import (
+	"math/rand/v2"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+)
+
+// Exists returns how many of keys exist. A key named twice is counted twice.
+func (db *DB) Exists(keys ...string) int {
+	return db.count(keys, db.peek)
+}
+
+// Touch is Exists that also records an access to each key, as TOUCH does.
+func (db *DB) Touch(keys ...string) int {
+	return db.count(keys, db.lookup)
+}
+
+func (db *DB) count(keys []string, find func(key, want string) (*Object, error)) int {
+	for _, key := range keys {
+		db.expireIfNeeded(key)
+	}
+
+	defer db.rlock(keys...)()
+	count := 0
+	for _, key := range keys {
+		if obj, _ := find(key, ""); obj != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Rename moves the value and expiry of src to dst, replacing dst. With nx
+// set, nothing happens if dst exists and false is returned.
+func (db *DB) Rename(src, dst string, nx bool) (bool, error) {
+	db.expireIfNeeded(src)
+	db.expireIfNeeded(dst)
+
+	unlock := db.lock(src, dst)
+	obj, _ := db.lookup(src, "")
+	if obj == nil {
+		unlock()
+		return false, resp.ErrNoSuchKey
+	}
+	if nx {
+		if existing, _ := db.lookup(dst, ""); existing != nil {
+			unlock()
+			return false, nil
+		}
+	}
+	if src != dst {
+		db.Store.remove(src)
+		db.Store.put(dst, obj)
+	}
+	unlock()
+
+	if obj.Type() == TypeList {
+		db.signalList(dst)
+	}
+	return true, nil
+}
+
+// Copy stores a copy of the value and expiry of src at dst in database to,
+// which may be db itself. It returns false if src does not exist, or if dst
+// exists and replace is not set.
+func (db *DB) Copy(src string, to *DB, dst string, replace bool) bool {
+	db.expireIfNeeded(src)
+	to.expireIfNeeded(dst)
+
+	unlock := db.lockRefs(true, []shardRef{{db, shardIndex(src)}, {to, shardIndex(dst)}})
+	obj, _ := db.lookup(src, "")
+	if obj == nil {
+		unlock()
+		return false
+	}
+	if existing, _ := to.lookup(dst, ""); existing != nil && !replace {
+		unlock()
+		return false
+	}
+	to.Store.put(dst, obj.clone())
+	unlock()
+
+	if obj.Type() == TypeList {
+		to.signalList(dst)
+	}
+	return true
+}
+
+// Move moves key, with its expiry, to database to. It returns false if the
+// key does not exist or to already holds it.
+func (db *DB) Move(key string, to *DB) bool {
+	db.expireIfNeeded(key)
+	to.expireIfNeeded(key)
+
+	unlock := db.lockRefs(true, []shardRef{{db, shardIndex(key)}, {to, shardIndex(key)}})
+	obj, _ := db.lookup(key, "")
+	if obj == nil {
+		unlock()
+		return false
+	}
+	if existing, _ := to.lookup(key, ""); existing != nil {
+		unlock()
+		return false
+	}
+	db.Store.remove(key)
+	to.Store.put(key, obj)
+	unlock()
+
+	if obj.Type() == TypeList {
+		to.signalList(key)
+	}
+	return true
+}
+
+// SwapDB exchanges the keys of db and other. Clients blocked on a list stay
+// with their database number and are woken to look at the new keys.
+func (db *DB) SwapDB(other *DB) {
+	if db.ID == other.ID {
+		return
+	}
+	unlock := db.lockAll(true, db, other)
+	swapContents(db.Store, other.Store)
+	unlock()
+
+	db.signalAllLists()
+	other.signalAllLists()
+}
+
+// Flush deletes every key of the database.
+func (db *DB) Flush() {
+	defer db.lockAll(true, db)()
+	db.Store.reset(nil)
+}
+
+// FlushAll deletes every key of every database.
+func (db *DB) FlushAll() {
+	for _, d := range db.Databases() {
+		d.Flush()
+	}
+}
+
+// Size returns the number of keys in the database, as DBSIZE does. Expired
+// keys a replica still holds are counted, as in Redis.
+func (db *DB) Size() int {
+	size := 0
+	for i := range shardCount {
+		sh, unlock := db.lockShard(i, false)
+		size += len(sh.Data)
+		unlock()
+	}
+	return size
+}
+
+// RandomKey returns a key that is not logically expired, or false if there
+// is none. Shards are tried from a random one.
+func (db *DB) RandomKey() (string, bool) {
+	now := time.Now().UnixMilli()
+	first := rand.IntN(shardCount)
+	for n := range shardCount {
+		sh, unlock := db.lockShard((first+n)%shardCount, false)
+		// Map iteration starts at a random position.
+		for key, obj := range sh.Data {
+			if !obj.expired(now) {
+				unlock()
+				return key, true
+			}
+		}
+		unlock()
+	}
+	return "", false
+}
+
+// clone returns a copy of o that shares nothing mutable with it. Stream
+// entries are never modified once added, so they can be shared. The copy
+// is a new key as far as eviction is concerned.
+func (o *Object) clone() *Object {
+	c := &Object{Value: o.Value, ExpireAt: o.ExpireAt}
+	switch v := o.Value.(type) {
+	case []string:
+		c.Value = append([]string(nil), v...)
+	case []StreamEntry:
+		c.Value = append([]StreamEntry(nil), v...)
+	}
+	return c
+}
+
+// Scan returns the keys in the next slice of the keyspace after cursor,
+// about count of them, and the cursor to continue from; 0 when the
+// iteration is complete. Keys holding another type than typ, if given, and
+// logically expired keys are left out, so fewer than count keys (or none)
+// may be returned before the end.
+//
+// The shards are walked one after the other: the low shardBits of the
+// cursor are the shard and the rest the cursor within its scanTable.
+func (db *DB) Scan(cursor uint64, count int, typ string) (uint64, []string) {
+	now := time.Now().UnixMilli()
+	var keys []string
+	visited := 0
+	i, inner := int(cursor&(shardCount-1)), cursor>>shardBits
+	for {
+		sh, unlock := db.lockShard(i, false)
+		inner = sh.keys.scan(inner, count-visited, func(key string) {
+			visited++
+			obj := sh.Data[key]
+			if obj.expired(now) || (typ != "" && obj.Type() != typ) {
+				return
+			}
+			keys = append(keys, key)
+		})
+		unlock()
+		if inner != 0 {
+			return inner<<shardBits | uint64(i), keys
+		}
+		if i++; i == shardCount {
+			return 0, keys
+		}
+		if visited >= count {
+			return uint64(i), keys
+		}
+	}
+}
@@ -2,108 +2,188 @@ package db
 
 import "sync"
 
-type ListStore struct {
-	List                map[string][]string
-	Mu                  sync.Mutex
-	blockingListClients map[string][]chan string
-	listMu              sync.Mutex
+// listWaiters tracks the clients blocked in BLPOP on each key. A push wakes
+// every waiter of the key; they then race to pop, and the ones that find the
+// list empty again go back to waiting.
+type listWaiters struct {
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
 }
 
-func NewListStore() *ListStore {
-	return &ListStore{
-		List:                make(map[string][]string),
-		blockingListClients: make(map[string][]chan string),
+func newListWaiters() *listWaiters {
+	return &listWaiters{waiters: make(map[string]map[chan struct{}]struct{})}
+}
+
+// WatchList returns a channel that receives a value when an element is
+// pushed to key. It must be released with UnwatchList. Watch before checking
+// the list, so that a push in between is not missed.
+func (db *DB) WatchList(key string) chan struct{} {
+	ch := make(chan struct{}, 1)
+	w := db.Store.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.waiters[key] == nil {
+		w.waiters[key] = make(map[chan struct{}]struct{})
 	}
+	w.waiters[key][ch] = struct{}{}
+	return ch
 }
 
-func (ls *ListStore) AddBlockingClient(key string, clientChan chan string) {
-	ls.listMu.Lock()
-	defer ls.listMu.Unlock()
-	ls.blockingListClients[key] = append(ls.blockingListClients[key], clientChan)
+func (db *DB) UnwatchList(key string, ch chan struct{}) {
+	w := db.Store.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.waiters[key], ch)
+	if len(w.waiters[key]) == 0 {
+		delete(w.waiters, key)
+	}
 }
 
-func (ls *ListStore) RemoveBlockingClient(key string, clientChan chan string) {
-	ls.listMu.Lock()
-	defer ls.listMu.Unlock()
-	if clients, ok := ls.blockingListClients[key]; ok {
-		for i, ch := range clients {
-			if ch == clientChan {
-				close(ch)
-				ls.blockingListClients[key] = append(clients[:i], clients[i+1:]...)
-				return
-			}
+func (db *DB) signalList(key string) {
+	w := db.Store.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for ch := range w.waiters[key] {
+		select {
+		case ch <- struct{}{}:
+		default:
 		}
 	}
 }
 
-func (ls *ListStore) WakeBlockingClient(key string, value string) {
-	ls.listMu.Lock()
-	defer ls.listMu.Unlock()
-	if clients, ok := ls.blockingListClients[key]; ok && len(clients) > 0 {
-		clientChan := clients[0]
-		clientChan <- value
-		ls.blockingListClients[key] = clients[1:]
+// signalAllLists wakes every client blocked on a list of the database, for
+// when all of its keys were replaced at once.
+func (db *DB) signalAllLists() {
+	w := db.Store.waiters
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, waiters := range w.waiters {
+		for ch := range waiters {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
 	}
 }
 
-func (ls *ListStore) LPop(key string, count int) []string {
-	ls.Mu.Lock()
-	defer ls.Mu.Unlock()
+// LPush prepends elements one by one, so the last one ends up first, and
+// returns the new length.
+func (db *DB) LPush(key string, elements []string) (int, error) {
+	return db.push(key, elements, true)
+}
 
-	list, ok := ls.List[key]
-	if !ok || len(list) == 0 {
-		return nil
+// RPush appends elements and returns the new length.
+func (db *DB) RPush(key string, elements []string) (int, error) {
+	return db.push(key, elements, false)
+}
+
+func (db *DB) push(key string, elements []string, left bool) (int, error) {
+	db.expireIfNeeded(key)
+
+	unlock := db.lock(key)
+	obj, err := db.lookup(key, TypeList)
+	if err != nil {
+		unlock()
+		return 0, err
 	}
+	if obj == nil {
+		// A replica may still hold an expired value under this name.
+		obj = &Object{Value: []string(nil)}
+		db.Store.put(key, obj)
+	}
+	list := obj.Value.([]string)
+	if left {
+		newList := make([]string, len(elements)+len(list))
+		for i := range elements {
+			newList[i] = elements[len(elements)-1-i]
+		}
+		copy(newList[len(elements):], list)
+		list = newList
+	} else {
+		list = append(list, elements...)
+	}
+	obj.Value = list
+	var added int64
+	for _, element := range elements {
+		added += listElementSize(element)
+	}
+	db.Store.grow(obj, added)
+	unlock()
 
+	if len(elements) > 0 {
+		db.signalList(key)
+	}
+	return len(list), nil
+}
+
+// LPop removes and returns up to count elements from the head of the list.
+// It returns nil when the key does not exist. Empty lists are deleted.
+func (db *DB) LPop(key string, count int) ([]string, error) {
+	db.expireIfNeeded(key)
+
+	defer db.lock(key)()
+	obj, err := db.lookupRead(key, TypeList)
+	if obj == nil {
+		return nil, err
+	}
+	list := obj.Value.([]string)
 	if count <= 0 {
-		return []string{}
+		return []string{}, nil
 	}
 
 	if count >= len(list) {
-		removedElements := list
-		delete(ls.List, key)
-		return removedElements
+		db.Store.remove(key)
+		return list, nil
 	}
-
-	removedElements := list[:count]
-	ls.List[key] = list[count:]
-	return removedElements
+	obj.Value = list[count:]
+	var removed int64
+	for _, element := range list[:count] {
+		removed += listElementSize(element)
+	}
+	db.Store.grow(obj, -removed)
+	return list[:count:count], nil
 }
 
-func (ls *ListStore) LPush(key string, elements []string) int {
-	ls.Mu.Lock()
-	defer ls.Mu.Unlock()
+// LRange returns the elements between start and end, both inclusive.
+// Negative indexes count from the end of the list.
+func (db *DB) LRange(key string, start, end int) ([]string, error) {
+	db.expireIfNeeded(key)
 
-	oldList := ls.List[key]
-	if _, ok := ls.List[key]; !ok {
-		ls.List[key] = make([]string, 0)
+	defer db.rlock(key)()
+	obj, err := db.lookupRead(key, TypeList)
+	if obj == nil {
+		return nil, err
 	}
+	list := obj.Value.([]string)
+	listLength := len(list)
 
-	newList := make([]string, len(elements)+len(oldList))
-	for i := range elements {
-		newList[i] = elements[len(elements)-1-i]
+	if start < 0 {
+		start = listLength + start
 	}
-	copy(newList[len(elements):], oldList)
-
-	ls.List[key] = newList
-	if len(elements) > 0 {
-		ls.WakeBlockingClient(key, elements[len(elements)-1])
+	if end < 0 {
+		end = listLength + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end >= listLength {
+		end = listLength - 1
 	}
-	return len(newList)
+	if start > end {
+		return nil, nil
+	}
+	return append([]string(nil), list[start:end+1]...), nil
 }
 
-func (ls *ListStore) RPush(key string, elements []string) int {
-	ls.Mu.Lock()
-	defer ls.Mu.Unlock()
-
-	if _, ok := ls.List[key]; !ok {
-		ls.List[key] = make([]string, 0)
-	}
+// LLen returns the length of the list at key, 0 if it does not exist.
+func (db *DB) LLen(key string) (int, error) {
+	db.expireIfNeeded(key)
 
-	oldLength := len(ls.List[key])
-	ls.List[key] = append(ls.List[key], elements...)
-	if len(ls.List[key]) > oldLength && len(elements) > 0 {
-		ls.WakeBlockingClient(key, elements[0])
+	defer db.rlock(key)()
+	obj, err := db.lookupRead(key, TypeList)
+	if obj == nil {
+		return 0, err
 	}
-	return len(ls.List[key])
+	return len(obj.Value.([]string)), nil
 }
@@ -0,0 +1,181 @@
+package db
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+)
+
+// Lock ordering. A command locks the shards of the keys it touches; when it
+// needs several, it takes them in (database, shard) order, so that two
+// commands can never each hold a shard the other is waiting for. Commands
+// walking a whole keyspace either lock one shard at a time or, when they
+// need a consistent view, every shard in order.
+//
+// A transaction locks the shards of all its commands up front, in the same
+// order, and runs them through a view of the database that knows which
+// shards are held, so they are not locked twice.
+//
+// Writes are propagated with the shards of their keys still locked, so that
+// they reach the replicas in the order they were made: a command locks its
+// keys with LockKeys, writes and propagates through the view it returns, and
+// the deletions the master makes on its own, of expired and evicted keys,
+// are propagated before their shard is unlocked. Propagating only takes the
+// replication locks, which are never held while waiting for a shard.
+
+// shardRef names a shard of a database.
+type shardRef struct {
+	db    *DB
+	index int
+}
+
+func compareShardRefs(a, b shardRef) int {
+	if c := cmp.Compare(a.db.ID, b.db.ID); c != 0 {
+		return c
+	}
+	return cmp.Compare(a.index, b.index)
+}
+
+// heldLocks are the shards locked by a transaction, or by a command
+// writing and propagating.
+type heldLocks struct {
+	all    bool
+	shards map[[2]int]bool // database ID and shard index
+}
+
+func (h *heldLocks) holds(r shardRef) bool {
+	return h != nil && (h.all || h.shards[[2]int{r.db.ID, r.index}])
+}
+
+func noUnlock() {}
+
+// lockRefs locks refs in order, for writing or for reading, skipping the
+// shards held by the transaction of db, and returns the function that
+// unlocks them. refs is reordered and may be overwritten.
+func (db *DB) lockRefs(write bool, refs []shardRef) func() {
+	slices.SortFunc(refs, compareShardRefs)
+	refs = slices.CompactFunc(refs, func(a, b shardRef) bool { return compareShardRefs(a, b) == 0 })
+	refs = slices.DeleteFunc(refs, db.held.holds)
+	if len(refs) == 0 {
+		return noUnlock
+	}
+	for _, r := range refs {
+		sh := &r.db.Store.shards[r.index]
+		if write {
+			sh.Mu.Lock()
+		} else {
+			sh.Mu.RLock()
+		}
+	}
+	return func() {
+		for i := len(refs) - 1; i >= 0; i-- {
+			sh := &refs[i].db.Store.shards[refs[i].index]
+			if write {
+				sh.Mu.Unlock()
+			} else {
+				sh.Mu.RUnlock()
+			}
+		}
+	}
+}
+
+// lock write-locks the shards of keys and returns the function that unlocks
+// them.
+func (db *DB) lock(keys ...string) func() {
+	return db.lockRefs(true, db.refs(keys))
+}
+
+// rlock read-locks the shards of keys and returns the function that unlocks
+// them.
+func (db *DB) rlock(keys ...string) func() {
+	return db.lockRefs(false, db.refs(keys))
+}
+
+func (db *DB) refs(keys []string) []shardRef {
+	refs := make([]shardRef, len(keys))
+	for i, key := range keys {
+		refs[i] = shardRef{db, shardIndex(key)}
+	}
+	return refs
+}
+
+// lockShard locks shard i of db on its own, for commands that walk the
+// keyspace one shard at a time, and returns it with the function that
+// unlocks it.
+func (db *DB) lockShard(i int, write bool) (*shard, func()) {
+	return &db.Store.shards[i], db.lockRefs(write, []shardRef{{db, i}})
+}
+
+// lockAll locks every shard of dbs and returns the function that unlocks
+// them.
+func (db *DB) lockAll(write bool, dbs ...*DB) func() {
+	refs := make([]shardRef, 0, len(dbs)*shardCount)
+	for _, d := range dbs {
+		for i := range shardCount {
+			refs = append(refs, shardRef{d, i})
+		}
+	}
+	return db.lockRefs(write, refs)
+}
+
+// KeyRef is a key of database DB that a queued command will touch.
+type KeyRef struct {
+	DB  int
+	Key string
+}
+
+// Lock write-locks the shards of keys, or every shard of every database if
+// all is set, and returns a view of db that does not lock them again, with
+// the function that releases them. A transaction runs its commands through
+// such a view, and a command runs its write and the propagation of it. The
+// shards the view db already holds stay held. Once released, a transaction
+// must go back to the database returned by Unlocked. Keys of databases that
+// do not exist are left out; the commands using them fail anyway.
+func (db *DB) Lock(keys []KeyRef, all bool) (*DB, func()) {
+	refs := make([]shardRef, 0, len(keys))
+	for _, k := range keys {
+		if k.DB >= 0 && k.DB < len(db.dbs) {
+			refs = append(refs, shardRef{db.dbs[k.DB], shardIndex(k.Key)})
+		}
+	}
+	return db.lockView(refs, all)
+}
+
+// LockKeys is Lock for keys of db.
+func (db *DB) LockKeys(keys ...string) (*DB, func()) {
+	return db.lockView(db.refs(keys), false)
+}
+
+func (db *DB) lockView(refs []shardRef, all bool) (*DB, func()) {
+	held := &heldLocks{all: all, shards: map[[2]int]bool{}}
+	if db.held != nil {
+		held.all = held.all || db.held.all
+		maps.Copy(held.shards, db.held.shards)
+	}
+	var unlock func()
+	if all {
+		unlock = db.lockAll(true, db.dbs...)
+	} else {
+		for _, r := range refs {
+			held.shards[[2]int{r.db.ID, r.index}] = true
+		}
+		unlock = db.lockRefs(true, refs)
+	}
+	view := *db.view(db.dbs[db.ID])
+	view.held = held
+	return &view, unlock
+}
+
+// Unlocked returns db without the locks of its transaction.
+func (db *DB) Unlocked() *DB {
+	view := *db
+	view.held = nil
+	return view.view(db.dbs[db.ID])
+}
+
+// InExec reports whether db holds shard locks, as the view a transaction
+// runs in does until EXEC is done, so that a command that would wait for
+// another client must answer at once instead.
+func (db *DB) InExec() bool {
+	return db.held != nil
+}
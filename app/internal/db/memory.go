@@ -0,0 +1,231 @@
+package db
+
+import (
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Memory accounting. Each object knows an estimate of the bytes it takes,
+// and each store the total for its keys, which is what maxmemory limits.
+// The estimates follow the shape of the Go values rather than measuring
+// the heap, so they are cheap to keep up to date and do not lag behind
+// the garbage collector.
+const (
+	keyOverhead         = 48 // map entry, string header and Object
+	stringOverhead      = 16
+	listOverhead        = 24
+	listElementOverhead = 16
+	streamEntryOverhead = 64 // entry, its ID and its field map
+	streamFieldOverhead = 32
+)
+
+// estimate returns the bytes taken by the value of o.
+func (o *Object) estimate() int64 {
+	switch v := o.Value.(type) {
+	case string:
+		return stringOverhead + int64(len(v))
+	case []string:
+		n := int64(listOverhead)
+		for _, element := range v {
+			n += listElementSize(element)
+		}
+		return n
+	case []StreamEntry:
+		n := int64(listOverhead)
+		for _, entry := range v {
+			n += streamEntrySize(entry)
+		}
+		return n
+	}
+	return 0
+}
+
+func listElementSize(element string) int64 {
+	return listElementOverhead + int64(len(element))
+}
+
+func streamEntrySize(entry StreamEntry) int64 {
+	n := int64(streamEntryOverhead + len(entry.ID))
+	for field, value := range entry.Fields {
+		n += streamFieldOverhead + int64(len(field)+len(value))
+	}
+	return n
+}
+
+// Memory returns the estimated bytes taken by the key and its value.
+func (o *Object) Memory(key string) int64 {
+	return keyOverhead + int64(len(key)) + o.mem
+}
+
+// LFU counters, as in Redis: a logarithmic access counter that starts at
+// lfuInitVal, so new keys are not evicted right away, and loses one every
+// lfu-decay-time minutes without access.
+const (
+	lfuInitVal = 5
+	lfuMax     = 255
+)
+
+var (
+	lfuLogFactor atomic.Int64
+	lfuDecayTime atomic.Int64 // minutes
+)
+
+func init() {
+	lfuLogFactor.Store(10)
+	lfuDecayTime.Store(1)
+}
+
+// SetLFULogFactor sets lfu-log-factor.
+func SetLFULogFactor(n int64) {
+	lfuLogFactor.Store(n)
+}
+
+// SetLFUDecayTime sets lfu-decay-time, in minutes.
+func SetLFUDecayTime(minutes int64) {
+	lfuDecayTime.Store(minutes)
+}
+
+// touch records an access to o for LRU and LFU eviction. It may be called
+// with the store only read-locked.
+func (o *Object) touch() {
+	now := time.Now().UnixMilli()
+	counter := o.lfuDecay(now)
+	if counter < lfuMax {
+		base := max(counter-lfuInitVal, 0)
+		if rand.Float64() < 1/float64(base*lfuLogFactor.Load()+1) {
+			counter++
+		}
+	}
+	o.freq.Store(counter)
+	o.accessed.Store(now)
+}
+
+// lfuDecay returns the LFU counter of o, less the periods elapsed since the
+// last access.
+func (o *Object) lfuDecay(nowMs int64) int64 {
+	counter := o.freq.Load()
+	decayTime := lfuDecayTime.Load()
+	if decayTime == 0 {
+		return counter
+	}
+	periods := (nowMs - o.accessed.Load()) / (decayTime * int64(time.Minute/time.Millisecond))
+	return max(counter-periods, 0)
+}
+
+// Freq returns the LFU counter of o, as OBJECT FREQ reports it.
+func (o *Object) Freq() int64 {
+	return o.lfuDecay(time.Now().UnixMilli())
+}
+
+// Idle returns the time since o was last accessed.
+func (o *Object) Idle() time.Duration {
+	return time.Duration(time.Now().UnixMilli()-o.accessed.Load()) * time.Millisecond
+}
+
+// Encodings reported by OBJECT ENCODING. Values are always stored the same
+// way here; these are the encodings Redis would pick for them, so that tools
+// written against Redis draw the same conclusions.
+const (
+	listpackMaxEntries = 128
+	listpackMaxValue   = 64
+	embstrMaxLen       = 44
+	sharedIntegers     = 10000
+)
+
+// Encoding returns the Redis encoding matching the value of o.
+func (o *Object) Encoding() string {
+	switch v := o.Value.(type) {
+	case string:
+		if len(v) <= 20 {
+			if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return "int"
+			}
+		}
+		if len(v) <= embstrMaxLen {
+			return "embstr"
+		}
+		return "raw"
+	case []string:
+		if len(v) > listpackMaxEntries {
+			return "quicklist"
+		}
+		for _, element := range v {
+			if len(element) > listpackMaxValue {
+				return "quicklist"
+			}
+		}
+		return "listpack"
+	case []StreamEntry:
+		return "stream"
+	}
+	return "unknown"
+}
+
+// ObjectInfo describes a key for MEMORY USAGE and OBJECT.
+type ObjectInfo struct {
+	Encoding string
+	Memory   int64 // bytes taken by the key and its value
+	Idle     time.Duration
+	Freq     int64
+	// RefCount is 1, or math.MaxInt32 for the small integers Redis shares
+	// between keys.
+	RefCount int64
+}
+
+// Inspect returns information about key without counting as an access to
+// it. It reports false if the key does not exist.
+func (db *DB) Inspect(key string) (ObjectInfo, bool) {
+	db.expireIfNeeded(key)
+
+	defer db.rlock(key)()
+	obj, _ := db.peek(key, "")
+	if obj == nil {
+		return ObjectInfo{}, false
+	}
+	info := ObjectInfo{
+		Encoding: obj.Encoding(),
+		Memory:   obj.Memory(key),
+		Idle:     obj.Idle(),
+		Freq:     obj.Freq(),
+		RefCount: 1,
+	}
+	if info.Encoding == "int" && db.sharesIntegers() {
+		if n, _ := strconv.ParseInt(obj.Value.(string), 10, 64); n >= 0 && n < sharedIntegers {
+			info.RefCount = math.MaxInt32
+		}
+	}
+	return info, true
+}
+
+// sharesIntegers reports whether Redis would share small integer values
+// between keys, which it does not when LRU or LFU eviction needs the
+// access time of each key.
+func (db *DB) sharesIntegers() bool {
+	policy := evictionPolicy(db.policy.Load())
+	return db.MaxMemory() == 0 || !(policy.lru() || policy.lfu())
+}
+
+// LFUPolicy reports whether maxmemory-policy is one of the LFU policies,
+// under which OBJECT FREQ is meaningful and OBJECT IDLETIME is not.
+func (db *DB) LFUPolicy() bool {
+	return evictionPolicy(db.policy.Load()).lfu()
+}
+
+// expireEntryOverhead is the size of an entry of the expires index, which
+// MEMORY STATS reports apart from the keys.
+const expireEntryOverhead = 24
+
+// HashtableOverhead returns the bytes taken by the bookkeeping of the keys
+// and of the expires index of db, for MEMORY STATS.
+func (db *DB) HashtableOverhead() (main, expires int64) {
+	for i := range shardCount {
+		sh, unlock := db.lockShard(i, false)
+		main += int64(len(sh.Data)) * keyOverhead
+		expires += int64(len(sh.expires)) * expireEntryOverhead
+		unlock()
+	}
+	return main, expires
+}
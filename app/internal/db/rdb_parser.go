@@ -10,7 +10,9 @@ import (
 	"strconv"
 )
 
-func ParseRDBFile(dir, filename string) (map[string]cacheValue, error) {
+// ParseRDBFile returns the keys of each database stored in the RDB file,
+// by database number.
+func ParseRDBFile(dir, filename string) (map[int]map[string]*Object, error) {
 	filePath := filepath.Join(dir, filename)
 	f, err := os.Open(filePath)
 	if err != nil {
@@ -32,7 +34,8 @@ func ParseRDBFile(dir, filename string) (map[string]cacheValue, error) {
 		return nil, fmt.Errorf("error reading RDB version: %w", err)
 	}
 
-	data := make(map[string]cacheValue)
+	dbs := map[int]map[string]*Object{0: make(map[string]*Object)}
+	data := dbs[0]
 	var ttl int64 = 0
 
 	for {
@@ -68,12 +71,50 @@ func ParseRDBFile(dir, filename string) (map[string]cacheValue, error) {
 			if err != nil {
 				return nil, err
 			}
-			data[key] = cacheValue{Value: value, Ttl: ttl}
+			data[key] = &Object{Value: value, ExpireAt: ttl}
+			ttl = 0
 
-		case 0xFE: // SELECT DB — skip
-			if _, err := readLength(reader); err != nil {
+		case 0x01: // List value
+			key, err := readString(reader)
+			if err != nil {
+				return nil, err
+			}
+			n, err := readLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			list := make([]string, 0, n)
+			for range n {
+				element, err := readString(reader)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, element)
+			}
+			data[key] = &Object{Value: list, ExpireAt: ttl}
+			ttl = 0
+
+		case 0x0F, 0x13, 0x15: // Stream value, versions 1 to 3
+			key, err := readString(reader)
+			if err != nil {
 				return nil, err
 			}
+			stream, err := readStream(reader, opcode)
+			if err != nil {
+				return nil, fmt.Errorf("error reading stream %q: %w", key, err)
+			}
+			data[key] = &Object{Value: stream, ExpireAt: ttl}
+			ttl = 0
+
+		case 0xFE: // SELECT DB
+			id, err := readLength(reader)
+			if err != nil {
+				return nil, err
+			}
+			if dbs[id] == nil {
+				dbs[id] = make(map[string]*Object)
+			}
+			data = dbs[id]
 		case 0xFA: // AUX field
 			if _, err := readString(reader); err != nil {
 				return nil, fmt.Errorf("error reading AUX key: %w", err)
@@ -89,12 +130,12 @@ func ParseRDBFile(dir, filename string) (map[string]cacheValue, error) {
 				return nil, err
 			}
 		case 0xFF: // End
-			return data, nil
+			return dbs, nil
 		default:
 			return nil, fmt.Errorf("unsupported opcode: 0x%x", opcode)
 		}
 	}
-	return data, nil
+	return dbs, nil
 }
 
 func readString(r *bufio.Reader) (string, error) {
@@ -157,7 +198,14 @@ func readLengthAndEncoding(r *bufio.Reader) (int, bool, error) {
 			return 0, false, err
 		}
 		return ((int(first) & 0x3F) << 8) | int(second), false, nil
-	case 2: // 32-bit length
+	case 2: // 32-bit or 64-bit length
+		if first == 0x81 {
+			var buf [8]byte
+			if _, err := io.ReadFull(r, buf[:]); err != nil {
+				return 0, false, err
+			}
+			return int(binary.BigEndian.Uint64(buf[:])), false, nil
+		}
 		var buf [4]byte
 		if _, err := io.ReadFull(r, buf[:]); err != nil {
 			return 0, false, err
@@ -181,3 +229,286 @@ func readLength(r *bufio.Reader) (int, error) {
 	}
 	return length, nil
 }
+
+// readStream reads a stream written as RDB type typ, 0x0F, 0x13 or 0x15.
+// Consumer groups are read past, since streams here have none.
+func readStream(r *bufio.Reader, typ byte) ([]StreamEntry, error) {
+	nodes, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	stream := []StreamEntry(nil)
+	for range nodes {
+		key, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 16 {
+			return nil, fmt.Errorf("invalid stream node key")
+		}
+		lp, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		ms := binary.BigEndian.Uint64([]byte(key[:8]))
+		seq := binary.BigEndian.Uint64([]byte(key[8:]))
+		if stream, err = readStreamNode(stream, []byte(lp), ms, seq); err != nil {
+			return nil, err
+		}
+	}
+
+	// Length and last ID, then from version 2 the first ID, the maximal
+	// deleted ID and the count of entries ever added.
+	fields := 3
+	if typ >= 0x13 {
+		fields += 5
+	}
+	for range fields {
+		if _, err := readLength(r); err != nil {
+			return nil, err
+		}
+	}
+
+	groups, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	for range groups {
+		if err := skipConsumerGroup(r, typ); err != nil {
+			return nil, fmt.Errorf("error reading consumer group: %w", err)
+		}
+	}
+	return stream, nil
+}
+
+// readStreamNode appends the live entries of a stream listpack to stream.
+// ms and seq are the ID the entry IDs of the node are relative to.
+func readStreamNode(stream []StreamEntry, lp []byte, ms, seq uint64) ([]StreamEntry, error) {
+	elements, err := readListpack(lp)
+	if err != nil {
+		return nil, err
+	}
+	i := 0
+	next := func() (string, error) {
+		if i == len(elements) {
+			return "", fmt.Errorf("truncated stream node")
+		}
+		i++
+		return elements[i-1], nil
+	}
+	nextInt := func() (int64, error) {
+		element, err := next()
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseInt(element, 10, 64)
+	}
+
+	// The master entry: count, deleted, the master fields, and a 0.
+	if _, err := nextInt(); err != nil {
+		return nil, err
+	}
+	if _, err := nextInt(); err != nil {
+		return nil, err
+	}
+	n, err := nextInt()
+	if err != nil || n < 0 || n > int64(len(elements)) {
+		return nil, fmt.Errorf("invalid stream master entry")
+	}
+	master := make([]string, n)
+	for j := range master {
+		if master[j], err = next(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := next(); err != nil {
+		return nil, err
+	}
+
+	for i < len(elements) {
+		flags, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		msDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		seqDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		fields := master
+		if flags&streamItemSameFields == 0 {
+			n, err := nextInt()
+			if err != nil || n < 0 || n > int64(len(elements)) {
+				return nil, fmt.Errorf("invalid stream entry")
+			}
+			fields = make([]string, n)
+		}
+		entry := StreamEntry{
+			ID:     fmt.Sprintf("%d-%d", ms+uint64(msDiff), seq+uint64(seqDiff)),
+			Fields: make(map[string]string, len(fields)),
+		}
+		for j := range fields {
+			field := fields[j]
+			if flags&streamItemSameFields == 0 {
+				if field, err = next(); err != nil {
+					return nil, err
+				}
+			}
+			if entry.Fields[field], err = next(); err != nil {
+				return nil, err
+			}
+		}
+		if _, err := next(); err != nil { // lp-count
+			return nil, err
+		}
+		if flags&streamItemDeleted == 0 {
+			stream = append(stream, entry)
+		}
+	}
+	return stream, nil
+}
+
+// readListpack returns the elements of a listpack, with integers formatted
+// in decimal.
+func readListpack(lp []byte) ([]string, error) {
+	invalid := fmt.Errorf("invalid listpack")
+	if len(lp) < 7 || int(binary.LittleEndian.Uint32(lp)) != len(lp) {
+		return nil, invalid
+	}
+	var elements []string
+	p := 6
+	for {
+		if p >= len(lp) {
+			return nil, invalid
+		}
+		b := lp[p]
+		if b == 0xFF {
+			return elements, nil
+		}
+		// size is the length of the encoding and the data; the string,
+		// if any, starts at p+header.
+		var size, header int
+		var v int64
+		isString := false
+		need := func(n int) bool { return p+n <= len(lp) }
+		switch {
+		case b&0x80 == 0:
+			size, v = 1, int64(b)
+		case b&0xC0 == 0x80:
+			header, isString = 1, true
+			size = header + int(b&0x3F)
+		case b&0xE0 == 0xC0:
+			if !need(2) {
+				return nil, invalid
+			}
+			size = 2
+			v = int64(b&0x1F)<<8 | int64(lp[p+1])
+			if v >= 1<<12 {
+				v -= 1 << 13
+			}
+		case b&0xF0 == 0xE0:
+			if !need(2) {
+				return nil, invalid
+			}
+			header, isString = 2, true
+			size = header + (int(b&0x0F)<<8 | int(lp[p+1]))
+		case b == 0xF0:
+			if !need(5) {
+				return nil, invalid
+			}
+			header, isString = 5, true
+			size = header + int(binary.LittleEndian.Uint32(lp[p+1:]))
+		case b == 0xF1:
+			size = 3
+		case b == 0xF2:
+			size = 4
+		case b == 0xF3:
+			size = 5
+		case b == 0xF4:
+			size = 9
+		default:
+			return nil, invalid
+		}
+		if size < header || !need(size+backlenSize(size)) {
+			return nil, invalid
+		}
+		switch b {
+		case 0xF1:
+			v = int64(int16(binary.LittleEndian.Uint16(lp[p+1:])))
+		case 0xF2:
+			v = int64(int32(uint32(lp[p+1])<<8|uint32(lp[p+2])<<16|uint32(lp[p+3])<<24) >> 8)
+		case 0xF3:
+			v = int64(int32(binary.LittleEndian.Uint32(lp[p+1:])))
+		case 0xF4:
+			v = int64(binary.LittleEndian.Uint64(lp[p+1:]))
+		}
+		if isString {
+			elements = append(elements, string(lp[p+header:p+size]))
+		} else {
+			elements = append(elements, strconv.FormatInt(v, 10))
+		}
+		p += size + backlenSize(size)
+	}
+}
+
+// skipConsumerGroup reads past a consumer group of a stream of RDB type
+// typ: its name, last delivered ID and entries read, its pending entries,
+// and its consumers with theirs.
+func skipConsumerGroup(r *bufio.Reader, typ byte) error {
+	if _, err := readString(r); err != nil {
+		return err
+	}
+	lengths := 2
+	if typ >= 0x13 {
+		lengths++
+	}
+	for range lengths {
+		if _, err := readLength(r); err != nil {
+			return err
+		}
+	}
+
+	// Each pending entry is an ID, a delivery time and a delivery count.
+	pending, err := readLength(r)
+	if err != nil {
+		return err
+	}
+	for range pending {
+		if _, err := r.Discard(16 + 8); err != nil {
+			return err
+		}
+		if _, err := readLength(r); err != nil {
+			return err
+		}
+	}
+
+	consumers, err := readLength(r)
+	if err != nil {
+		return err
+	}
+	for range consumers {
+		if _, err := readString(r); err != nil {
+			return err
+		}
+		// Seen time, and from version 3 active time.
+		times := 8
+		if typ >= 0x15 {
+			times += 8
+		}
+		if _, err := r.Discard(times); err != nil {
+			return err
+		}
+		// The IDs of the consumer's pending entries.
+		ids, err := readLength(r)
+		if err != nil {
+			return err
+		}
+		if _, err := r.Discard(16 * ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
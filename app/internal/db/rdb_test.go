@@ -0,0 +1,103 @@
+package db
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestListpackRoundTrip(t *testing.T) {
+	var want []string
+	lp := newListpack()
+	for _, v := range []int64{
+		0, 127, 128, -1, 4095, -4096, 4096, -4097,
+		math.MaxInt16, math.MinInt16, math.MaxInt16 + 1, 1<<23 - 1, -1 << 23, 1 << 23,
+		math.MaxInt32, math.MinInt32, math.MaxInt32 + 1, math.MaxInt64, math.MinInt64,
+	} {
+		lp.int(v)
+		want = append(want, strconv.FormatInt(v, 10))
+	}
+	for _, n := range []int{0, 63, 64, 127, 128, 4095, 4096, 20000} {
+		s := strings.Repeat("x", n)
+		lp.string(s)
+		want = append(want, s)
+	}
+
+	got, err := readListpack(lp.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("readListpack returned %d elements, want %d, or they differ", len(got), len(want))
+	}
+}
+
+func TestReadListpackRejectsTruncated(t *testing.T) {
+	lp := newListpack()
+	lp.string("hello")
+	lp.int(1000)
+	b := lp.bytes()
+	for n := range len(b) - 1 {
+		truncated := append([]byte(nil), b[:n]...)
+		if _, err := readListpack(truncated); err == nil {
+			t.Fatalf("readListpack accepted the first %d of %d bytes", n, len(b))
+		}
+	}
+}
+
+func TestRDBRoundTrip(t *testing.T) {
+	var stream []StreamEntry
+	ms := int64(1700000000000)
+	for i := range 250 {
+		// IDs far apart exercise every integer encoding of the deltas,
+		// and a lower sequence number a negative one.
+		ms += int64(i) * int64(i) * int64(i) * 1000
+		fields := map[string]string{"temperature": strconv.Itoa(i), "humidity": "high"}
+		if i%7 == 0 {
+			fields = map[string]string{"other": strings.Repeat("v", i*20)}
+		}
+		stream = append(stream, StreamEntry{ID: fmt.Sprintf("%d-%d", ms, 5-i%3), Fields: fields})
+	}
+
+	dbs := [][]entry{
+		{
+			{key: "string", value: "value"},
+			{key: "list", value: []string{"a", "b", "c"}, expireAt: 4102444800000},
+			{key: "stream", value: stream, expireAt: 4102444800000},
+			{key: "one", value: []StreamEntry{{ID: "1-1", Fields: map[string]string{"f": "v"}}}},
+		},
+		nil,
+		{{key: "in db 2", value: "x"}},
+	}
+	dir := t.TempDir()
+	if err := writeRDBFile(filepath.Join(dir, "dump.rdb"), dbs); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ParseRDBFile(dir, "dump.rdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for id, entries := range dbs {
+		for _, e := range entries {
+			obj, ok := loaded[id][e.key]
+			if !ok {
+				t.Fatalf("db %d: %q was not loaded", id, e.key)
+			}
+			if !reflect.DeepEqual(obj.Value, e.value) || obj.ExpireAt != e.expireAt {
+				t.Errorf("db %d: %q loaded as %v expiring at %d", id, e.key, obj.Value, obj.ExpireAt)
+			}
+		}
+	}
+}
+
+func TestRDBRejectsInvalidStreamID(t *testing.T) {
+	dbs := [][]entry{{{key: "s", value: []StreamEntry{{ID: "abc", Fields: map[string]string{"f": "v"}}}}}}
+	if err := writeRDBFile(filepath.Join(t.TempDir(), "dump.rdb"), dbs); err == nil {
+		t.Fatal("a stream with an invalid ID was saved")
+	}
+}
@@ -0,0 +1,467 @@
+package db
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc64"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+)
+
+// RDB value types and opcodes written by writeRDB, a subset of what
+// ParseRDBFile reads.
+const (
+	rdbTypeString   = 0x00
+	rdbTypeList     = 0x01
+	rdbTypeStream   = 0x15 // RDB_TYPE_STREAM_LISTPACKS_3
+	rdbOpExpireMs   = 0xFC
+	rdbOpSelectDB   = 0xFE
+	rdbOpResizeDB   = 0xFB
+	rdbOpAux        = 0xFA
+	rdbOpEOF        = 0xFF
+	rdbVersion      = "0011"
+	rdbChecksumPoly = 0x95ac9329ac4bc9b5 // CRC-64/Jones, reflected, as Redis uses
+)
+
+var crcTable = crc64.MakeTable(rdbChecksumPoly)
+
+var ErrSaveInProgress = errors.New("Background save already in progress")
+
+// entry is a key as captured for a snapshot.
+type entry struct {
+	key      string
+	value    any
+	expireAt int64
+}
+
+// snapshot captures the keys of every database, by database number.
+// Values are never modified in place (lists and streams are replaced or only
+// appended to), so the captured values can be written out after the locks
+// are released.
+func (db *DB) snapshot() [][]entry {
+	now := time.Now().UnixMilli()
+	dbs := make([][]entry, len(db.dbs))
+	for id, d := range db.Databases() {
+		// Each database is captured as of one instant, as SAVE did
+		// before the keyspace was sharded.
+		unlock := d.lockAll(false, d)
+		var entries []entry
+		for i := range d.Store.shards {
+			for key, obj := range d.Store.shards[i].Data {
+				if !obj.expired(now) {
+					entries = append(entries, entry{key, obj.Value, obj.ExpireAt})
+				}
+			}
+		}
+		unlock()
+		dbs[id] = entries
+	}
+	return dbs
+}
+
+// Save writes the keyspace to dir/dbfilename, as SAVE does.
+func (db *DB) Save() error {
+	if !db.saving.CompareAndSwap(false, true) {
+		return ErrSaveInProgress
+	}
+	defer db.saving.Store(false)
+	return db.writeSnapshot(db.snapshot())
+}
+
+// BGSave captures the keyspace and writes it in the background.
+func (db *DB) BGSave() error {
+	if !db.saving.CompareAndSwap(false, true) {
+		return ErrSaveInProgress
+	}
+	dbs := db.snapshot()
+	go func() {
+		defer db.saving.Store(false)
+		if err := db.writeSnapshot(dbs); err != nil {
+			logger.Warning("Background saving error", "err", err)
+			return
+		}
+		logger.Notice("Background saving terminated with success")
+	}()
+	return nil
+}
+
+// Saving reports whether a SAVE or BGSAVE is running.
+func (db *DB) Saving() bool {
+	return db.saving.Load()
+}
+
+// LastSave returns the unix time of the last successful save, or of the
+// start of the server if there was none.
+func (db *DB) LastSave() int64 {
+	if t := db.lastSave.Load(); t != 0 {
+		return t
+	}
+	return stats.StartTime.Unix()
+}
+
+// LastSaveOK reports whether the last save succeeded.
+func (db *DB) LastSaveOK() bool {
+	return !db.lastSaveFailed.Load()
+}
+
+// writeSnapshot writes a snapshot to a temporary file and renames it over
+// the RDB file, so a crash never leaves a truncated file behind.
+func (db *DB) writeSnapshot(dbs [][]entry) error {
+	dir, fileName := db.Config.Get("dir"), db.Config.Get("dbfilename")
+	path := filepath.Join(dir, fileName)
+	tmp := filepath.Join(dir, fmt.Sprintf("temp-%d.rdb", os.Getpid()))
+
+	err := writeRDBFile(tmp, dbs)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		db.lastSaveFailed.Store(true)
+		return err
+	}
+	db.lastSave.Store(time.Now().Unix())
+	db.lastSaveFailed.Store(false)
+	logger.Notice("DB saved on disk", "path", path)
+	return nil
+}
+
+func writeRDBFile(path string, dbs [][]entry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = writeRDB(w, dbs)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeRDB encodes the databases in the RDB format, skipping empty ones.
+// Keys are written with their expiry.
+func writeRDB(out io.Writer, dbs [][]entry) error {
+	w := &rdbWriter{w: out}
+	w.raw([]byte("REDIS" + rdbVersion))
+	w.aux("redis-ver", "7.2.0")
+	w.aux("redis-bits", "64")
+	w.aux("ctime", fmt.Sprint(time.Now().Unix()))
+
+	for id, entries := range dbs {
+		if len(entries) > 0 {
+			w.db(id, entries)
+		}
+	}
+
+	w.byte(rdbOpEOF)
+	var sum [8]byte
+	binary.LittleEndian.PutUint64(sum[:], w.crc)
+	w.raw(sum[:])
+	return w.err
+}
+
+// db writes the keys of database id.
+func (w *rdbWriter) db(id int, entries []entry) {
+	expires := 0
+	for _, e := range entries {
+		if e.expireAt > 0 {
+			expires++
+		}
+	}
+	w.byte(rdbOpSelectDB)
+	w.length(uint64(id))
+	w.byte(rdbOpResizeDB)
+	w.length(uint64(len(entries)))
+	w.length(uint64(expires))
+
+	for _, e := range entries {
+		var typ byte
+		switch e.value.(type) {
+		case string:
+			typ = rdbTypeString
+		case []string:
+			typ = rdbTypeList
+		case []StreamEntry:
+			typ = rdbTypeStream
+		}
+		if e.expireAt > 0 {
+			w.byte(rdbOpExpireMs)
+			var ms [8]byte
+			binary.LittleEndian.PutUint64(ms[:], uint64(e.expireAt))
+			w.raw(ms[:])
+		}
+		w.byte(typ)
+		w.string(e.key)
+		switch v := e.value.(type) {
+		case string:
+			w.string(v)
+		case []string:
+			w.length(uint64(len(v)))
+			for _, element := range v {
+				w.string(element)
+			}
+		case []StreamEntry:
+			w.stream(v)
+		}
+	}
+}
+
+// streamNodeMaxEntries is how many entries go in one listpack, as Redis'
+// default stream-node-max-entries.
+const streamNodeMaxEntries = 100
+
+// stream writes a stream as Redis 7.2 does: the listpacks of its radix
+// tree, each keyed by the ID of its first entry, then the length, the IDs
+// bounding it and its consumer groups, of which there are none.
+func (w *rdbWriter) stream(entries []StreamEntry) {
+	ids := make([][2]uint64, len(entries))
+	for i, e := range entries {
+		ms, seq, err := parseStreamID(e.ID)
+		if err != nil {
+			if w.err == nil {
+				w.err = err
+			}
+			return
+		}
+		ids[i] = [2]uint64{ms, seq}
+	}
+
+	w.length(uint64((len(entries) + streamNodeMaxEntries - 1) / streamNodeMaxEntries))
+	for start := 0; start < len(entries); start += streamNodeMaxEntries {
+		end := min(start+streamNodeMaxEntries, len(entries))
+		var key [16]byte
+		binary.BigEndian.PutUint64(key[:8], ids[start][0])
+		binary.BigEndian.PutUint64(key[8:], ids[start][1])
+		w.string(string(key[:]))
+		w.string(string(streamNode(entries[start:end], ids[start:end])))
+	}
+
+	var first, last [2]uint64
+	if len(ids) > 0 {
+		first, last = ids[0], ids[len(ids)-1]
+	}
+	w.length(uint64(len(entries)))
+	w.length(last[0])
+	w.length(last[1])
+	w.length(first[0])
+	w.length(first[1])
+	w.length(0) // max deleted entry ID
+	w.length(0)
+	w.length(uint64(len(entries))) // entries added
+	w.length(0)                    // consumer groups
+}
+
+// Flags of the entries of a stream listpack.
+const (
+	streamItemDeleted    = 1
+	streamItemSameFields = 2
+)
+
+// streamNode encodes entries as the listpack of a stream node. The master
+// entry holds the fields of the first entry, and entries with the same
+// fields only store their values. IDs are stored relative to the first one.
+func streamNode(entries []StreamEntry, ids [][2]uint64) []byte {
+	master := slices.Sorted(maps.Keys(entries[0].Fields))
+	lp := newListpack()
+	lp.int(int64(len(entries)))
+	lp.int(0) // deleted
+	lp.int(int64(len(master)))
+	for _, field := range master {
+		lp.string(field)
+	}
+	lp.int(0)
+
+	for i, e := range entries {
+		fields := slices.Sorted(maps.Keys(e.Fields))
+		same := slices.Equal(fields, master)
+		flags, count := 0, len(fields)+3
+		if same {
+			flags = streamItemSameFields
+		} else {
+			count += len(fields) + 1
+		}
+		lp.int(int64(flags))
+		lp.int(int64(ids[i][0] - ids[0][0]))
+		lp.int(int64(ids[i][1] - ids[0][1]))
+		if !same {
+			lp.int(int64(len(fields)))
+		}
+		for _, field := range fields {
+			if !same {
+				lp.string(field)
+			}
+			lp.string(e.Fields[field])
+		}
+		lp.int(int64(count))
+	}
+	return lp.bytes()
+}
+
+// parseStreamID splits a stream ID into its milliseconds and sequence
+// number. A bare number is an ID with sequence number 0.
+func parseStreamID(id string) (ms, seq uint64, err error) {
+	msPart, seqPart, found := strings.Cut(id, "-")
+	ms, err = strconv.ParseUint(msPart, 10, 64)
+	if err == nil && found {
+		seq, err = strconv.ParseUint(seqPart, 10, 64)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream ID %q", id)
+	}
+	return ms, seq, nil
+}
+
+// listpack builds a listpack, the compact encoding of a list of strings
+// and integers Redis stores stream nodes in: a header with the total size
+// and the number of elements, the elements, and an end marker. Each
+// element is its encoding and data followed by their length, written so
+// that it can be read backwards.
+type listpack struct {
+	buf []byte
+	n   int
+}
+
+func newListpack() *listpack {
+	return &listpack{buf: make([]byte, 6)}
+}
+
+func (lp *listpack) int(v int64) {
+	var element []byte
+	switch {
+	case v >= 0 && v <= 127:
+		element = []byte{byte(v)}
+	case v >= -1<<12 && v < 1<<12:
+		element = []byte{0xC0 | byte(v>>8)&0x1F, byte(v)}
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		element = binary.LittleEndian.AppendUint16([]byte{0xF1}, uint16(v))
+	case v >= -1<<23 && v < 1<<23:
+		element = []byte{0xF2, byte(v), byte(v >> 8), byte(v >> 16)}
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		element = binary.LittleEndian.AppendUint32([]byte{0xF3}, uint32(v))
+	default:
+		element = binary.LittleEndian.AppendUint64([]byte{0xF4}, uint64(v))
+	}
+	lp.append(element)
+}
+
+func (lp *listpack) string(s string) {
+	var element []byte
+	switch n := len(s); {
+	case n < 1<<6:
+		element = []byte{0x80 | byte(n)}
+	case n < 1<<12:
+		element = []byte{0xE0 | byte(n>>8), byte(n)}
+	default:
+		element = binary.LittleEndian.AppendUint32([]byte{0xF0}, uint32(n))
+	}
+	lp.append(append(element, s...))
+}
+
+func (lp *listpack) append(element []byte) {
+	lp.buf = append(lp.buf, element...)
+	// The length is written big-endian in groups of 7 bits, with the high
+	// bit set on all but the first byte.
+	n := len(element)
+	size := backlenSize(n)
+	for i := size - 1; i >= 0; i-- {
+		b := byte(n>>(7*i)) & 0x7F
+		if i != size-1 {
+			b |= 0x80
+		}
+		lp.buf = append(lp.buf, b)
+	}
+	lp.n++
+}
+
+func (lp *listpack) bytes() []byte {
+	lp.buf = append(lp.buf, 0xFF)
+	binary.LittleEndian.PutUint32(lp.buf, uint32(len(lp.buf)))
+	binary.LittleEndian.PutUint16(lp.buf[4:], uint16(min(lp.n, math.MaxUint16)))
+	return lp.buf
+}
+
+// backlenSize returns how many bytes the length of an element of n bytes
+// takes in a listpack.
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// rdbWriter keeps the running checksum and the first write error.
+type rdbWriter struct {
+	w   io.Writer
+	crc uint64
+	err error
+}
+
+func (w *rdbWriter) raw(p []byte) {
+	if w.err != nil {
+		return
+	}
+	// Redis' CRC64 has no initial or final inversion, unlike hash/crc64.
+	w.crc = ^crc64.Update(^w.crc, crcTable, p)
+	_, w.err = w.w.Write(p)
+}
+
+func (w *rdbWriter) byte(b byte) {
+	w.raw([]byte{b})
+}
+
+// length writes n with the RDB length encoding.
+func (w *rdbWriter) length(n uint64) {
+	switch {
+	case n < 1<<6:
+		w.byte(byte(n))
+	case n < 1<<14:
+		w.raw([]byte{byte(n>>8) | 0x40, byte(n)})
+	case n <= 0xFFFFFFFF:
+		var buf [5]byte
+		buf[0] = 0x80
+		binary.BigEndian.PutUint32(buf[1:], uint32(n))
+		w.raw(buf[:])
+	default:
+		var buf [9]byte
+		buf[0] = 0x81
+		binary.BigEndian.PutUint64(buf[1:], n)
+		w.raw(buf[:])
+	}
+}
+
+func (w *rdbWriter) string(s string) {
+	w.length(uint64(len(s)))
+	w.raw([]byte(s))
+}
+
+func (w *rdbWriter) aux(key, value string) {
+	w.byte(rdbOpAux)
+	w.string(key)
+	w.string(value)
+}
@@ -1,19 +1,86 @@
 package db
 
 import (
+	"errors"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/output"
 )
 
+var ErrOutputBufferLimit = errors.New("replica output buffer limit reached")
+
 type Replication struct {
 	ID              string
-	Offset          int
+	Offset          atomic.Int64
 	Replicas        []*ReplicaConn
 	ReplicaMu       sync.RWMutex
 	NumAcksRecieved int64
+	// Number of replicas disconnected for overcoming the replica class of
+	// client-output-buffer-limit.
+	OutputBufferDisconnects int64
+
+	// The master link as seen by a replica, for INFO replication.
+	MasterHost   string
+	MasterPort   string
+	MasterLinkUp atomic.Bool
+	MasterLastIO atomic.Int64 // unix seconds
 }
 
+// ReplicaConn is a replica connection as seen by the master. Its output
+// queue is the one the connection was already using for replies, so
+// propagated commands, GETACKs and replies share a single writer and a slow
+// replica never blocks the client that issued the write.
 type ReplicaConn struct {
 	Conn net.Conn
+	Out  *output.Queue
 	Mu   sync.Mutex
+
+	ackOffset int64
+	lastAck   time.Time
+}
+
+func newReplicaConn(conn net.Conn, out *output.Queue) *ReplicaConn {
+	out.SetClass(output.Replica)
+	return &ReplicaConn{Conn: conn, Out: out, lastAck: time.Now()}
+}
+
+// Ack records a REPLCONF ACK from the replica.
+func (r *ReplicaConn) Ack(offset int64) {
+	r.Mu.Lock()
+	r.ackOffset = offset
+	r.lastAck = time.Now()
+	r.Mu.Unlock()
+}
+
+// AckState returns the last offset the replica acknowledged and how long ago
+// it did so.
+func (r *ReplicaConn) AckState() (int64, time.Duration) {
+	r.Mu.Lock()
+	defer r.Mu.Unlock()
+	return r.ackOffset, time.Since(r.lastAck)
+}
+
+// Enqueue queues data for the replica. If the queue grows past the replica
+// output buffer limit the replica is disconnected and ErrOutputBufferLimit
+// is returned.
+func (r *ReplicaConn) Enqueue(data []byte) error {
+	_, err := r.Out.Send(data)
+	if errors.Is(err, output.ErrLimit) {
+		return ErrOutputBufferLimit
+	}
+	return err
+}
+
+// OutputBufferSize returns the number of queued bytes not yet written to the
+// socket and the highest value it has reached.
+func (r *ReplicaConn) OutputBufferSize() (int64, int64) {
+	return r.Out.Pending()
+}
+
+// Close drops anything still queued and closes the connection.
+func (r *ReplicaConn) Close() {
+	r.Out.Abort()
 }
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"slices"
+)
+
+// scanSeed hashes members into scanTable buckets. Cursors are only
+// meaningful within one process, as in Redis.
+var scanSeed = maphash.MakeSeed()
+
+// scanTable is a set of strings kept in 2^n hash buckets so it can be
+// iterated with a cursor between calls, the way Redis' dictScan walks a
+// dict. The cursor is a bucket index incremented in reverse bit order: when
+// the table doubles, the buckets a cursor has already passed map to
+// buckets it has already passed in the larger table, so a member present
+// for the whole iteration is returned at least once (possibly twice).
+//
+// Go maps cannot resume an iteration, so collections that need a cursor
+// keep a scanTable next to their map.
+type scanTable struct {
+	buckets [][]string
+	count   int
+}
+
+const scanTableMinSize = 16
+
+func (t *scanTable) bucket(member string) uint64 {
+	return maphash.String(scanSeed, member) & uint64(len(t.buckets)-1)
+}
+
+// add inserts member, which must not already be in t.
+func (t *scanTable) add(member string) {
+	if t.count >= len(t.buckets) {
+		t.resize(max(2*len(t.buckets), scanTableMinSize))
+	}
+	b := t.bucket(member)
+	t.buckets[b] = append(t.buckets[b], member)
+	t.count++
+}
+
+// remove deletes member if it is in t.
+func (t *scanTable) remove(member string) {
+	if len(t.buckets) == 0 {
+		return
+	}
+	b := t.bucket(member)
+	i := slices.Index(t.buckets[b], member)
+	if i < 0 {
+		return
+	}
+	last := len(t.buckets[b]) - 1
+	t.buckets[b][i] = t.buckets[b][last]
+	t.buckets[b][last] = ""
+	t.buckets[b] = t.buckets[b][:last]
+	t.count--
+}
+
+// resize rehashes every member into size buckets. The table only grows, so
+// a long-running SCAN never has to cope with buckets being merged.
+func (t *scanTable) resize(size int) {
+	old := t.buckets
+	t.buckets = make([][]string, size)
+	for _, bucket := range old {
+		for _, member := range bucket {
+			b := t.bucket(member)
+			t.buckets[b] = append(t.buckets[b], member)
+		}
+	}
+}
+
+// scan calls fn for the members of the buckets starting at cursor until at
+// least count members were visited, or 10*count buckets were, and returns
+// the cursor to resume from; 0 once the whole table has been walked.
+func (t *scanTable) scan(cursor uint64, count int, fn func(member string)) uint64 {
+	if len(t.buckets) == 0 {
+		return 0
+	}
+	mask := uint64(len(t.buckets) - 1)
+	visited := 0
+	for steps := 0; steps < 10*count; steps++ {
+		for _, member := range t.buckets[cursor&mask] {
+			fn(member)
+			visited++
+		}
+		// Increment the high bits of the cursor that are not masked out.
+		cursor |= ^mask
+		cursor = bits.Reverse64(bits.Reverse64(cursor) + 1)
+		if cursor == 0 || visited >= count {
+			break
+		}
+	}
+	return cursor
+}
@@ -0,0 +1,98 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+// A member present for the whole iteration is returned at least once, even
+// when the table doubles several times between two calls.
+func TestScanTableGrowing(t *testing.T) {
+	var table scanTable
+	for i := range 100 {
+		table.add(fmt.Sprintf("old:%d", i))
+	}
+	seen := map[string]bool{}
+	added := 0
+	cursor := uint64(0)
+	for {
+		cursor = table.scan(cursor, 5, func(member string) { seen[member] = true })
+		if cursor == 0 {
+			break
+		}
+		for i := 0; i < 50 && added < 2000; i++ {
+			table.add(fmt.Sprintf("new:%d", added))
+			added++
+		}
+	}
+	if len(table.buckets) < 1024 {
+		t.Fatalf("the table only grew to %d buckets", len(table.buckets))
+	}
+	for i := range 100 {
+		if !seen[fmt.Sprintf("old:%d", i)] {
+			t.Errorf("old:%d was never returned", i)
+		}
+	}
+}
+
+func TestScanTableRemove(t *testing.T) {
+	var table scanTable
+	for i := range 100 {
+		table.add(fmt.Sprint(i))
+	}
+	for i := 0; i < 100; i += 2 {
+		table.remove(fmt.Sprint(i))
+	}
+	table.remove("missing")
+	seen := map[string]int{}
+	for cursor := table.scan(0, 10, func(m string) { seen[m]++ }); cursor != 0; {
+		cursor = table.scan(cursor, 10, func(m string) { seen[m]++ })
+	}
+	if len(seen) != 50 || table.count != 50 {
+		t.Fatalf("%d members returned, count %d; want 50", len(seen), table.count)
+	}
+	for m, n := range seen {
+		if n != 1 {
+			t.Errorf("%s returned %d times without the table changing", m, n)
+		}
+	}
+}
+
+// SCAN keeps its guarantee across the shards while keys are added to all
+// of them between calls, and skips expired keys and other types.
+func TestScanWhileGrowing(t *testing.T) {
+	db := New("master", 16)
+	for i := range 1000 {
+		db.Set(fmt.Sprintf("old:%d", i), "v", 0)
+	}
+	db.RPush("list", []string{"a"})
+	seen := map[string]bool{}
+	added := 0
+	cursor, calls := uint64(0), 0
+	for {
+		var keys []string
+		cursor, keys = db.Scan(cursor, 10, TypeString)
+		for _, key := range keys {
+			seen[key] = true
+		}
+		calls++
+		if cursor == 0 {
+			break
+		}
+		for i := 0; i < 50 && added < 4000; i++ {
+			db.Set(fmt.Sprintf("new:%d", added), "v", 0)
+			added++
+		}
+	}
+	if calls < 20 {
+		t.Fatalf("the scan ended after %d calls", calls)
+	}
+	for i := range 1000 {
+		if !seen[fmt.Sprintf("old:%d", i)] {
+			t.Errorf("old:%d was never returned", i)
+		}
+	}
+	if seen["list"] {
+		t.Error("TYPE string returned a list")
+	}
+}
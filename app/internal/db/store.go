@@ -1,11 +1,200 @@
 package db
 
-import "sync"
+import (
+	"hash/maphash"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
+// Store is the keyspace: every key, whatever the type of its value, lives in
+// one map, so a name can only ever hold one value. The map is split by key
+// hash into shardCount shards, each with its own lock, so that commands on
+// different keys do not contend. Keys are added and removed with put and
+// remove, which keep the indexes of the shard in step with its map.
 type Store struct {
-	Data    map[string]cacheValue
-	Streams map[string][]StreamEntry
-	Mu      sync.RWMutex
+	shards [shardCount]shard
+
+	// waiters are the clients blocked on lists of this keyspace. They stay
+	// with the database number when SWAPDB exchanges keyspaces.
+	waiters *listWaiters
+
+	// used is the estimated memory taken by the keys, see Object.Memory.
+	// It is only changed with the lock of the key's shard held, but read
+	// without any.
+	used atomic.Int64
+}
+
+// shardCount is the number of shards of every Store.
+const (
+	shardBits  = 4
+	shardCount = 1 << shardBits
+)
+
+// shardSeed picks the shard of a key. It is not scanSeed, so that the keys
+// of a shard still spread over all the buckets of its scanTable.
+var shardSeed = maphash.MakeSeed()
+
+// shard is one lock-striped part of a Store. Mu guards Data, the objects in
+// it and the indexes below.
+type shard struct {
+	Mu   sync.RWMutex
+	Data map[string]*Object
+
+	// keys holds the keys of Data for SCAN cursors.
+	keys scanTable
+
+	// expires indexes the keys that may have an expiry, for the active
+	// expire cycle to sample. Every key with an expiry is in it; keys that
+	// were deleted or persisted since are dropped when the cycle meets them.
+	expires map[string]struct{}
+}
+
+func newStore(data map[string]*Object) *Store {
+	s := &Store{waiters: newListWaiters()}
+	s.reset(data)
+	return s
+}
+
+// shardIndex returns the index of the shard holding key.
+func shardIndex(key string) int {
+	return int(maphash.String(shardSeed, key) & (shardCount - 1))
+}
+
+// shard returns the shard holding key.
+func (s *Store) shard(key string) *shard {
+	return &s.shards[shardIndex(key)]
+}
+
+// get returns the object stored at key, expired or not. Callers must hold
+// the lock of the key's shard.
+func (s *Store) get(key string) (*Object, bool) {
+	obj, ok := s.shard(key).Data[key]
+	return obj, ok
+}
+
+// reset replaces the contents of s with data. Callers must hold every
+// shard lock.
+func (s *Store) reset(data map[string]*Object) {
+	for i := range s.shards {
+		s.shards[i].Data = make(map[string]*Object)
+		s.shards[i].keys = scanTable{}
+		s.shards[i].expires = make(map[string]struct{})
+	}
+	s.used.Store(0)
+	for key, obj := range data {
+		s.put(key, obj)
+	}
+}
+
+// swapContents exchanges the keys of a and b, leaving their locks and
+// waiters in place. Callers must hold every shard lock of both.
+func swapContents(a, b *Store) {
+	for i := range a.shards {
+		x, y := &a.shards[i], &b.shards[i]
+		x.Data, y.Data = y.Data, x.Data
+		x.keys, y.keys = y.keys, x.keys
+		x.expires, y.expires = y.expires, x.expires
+	}
+	used := a.used.Load()
+	a.used.Store(b.used.Load())
+	b.used.Store(used)
+}
+
+// Used returns the estimated memory taken by the keys of s.
+func (s *Store) Used() int64 {
+	return s.used.Load()
+}
+
+// put stores obj at key, replacing any value. Objects that were never
+// stored before get their memory estimate and access time here. Callers
+// must hold the lock of the key's shard.
+func (s *Store) put(key string, obj *Object) {
+	sh := s.shard(key)
+	if old, ok := sh.Data[key]; ok {
+		s.used.Add(-old.Memory(key))
+	} else {
+		sh.keys.add(key)
+	}
+	obj.init()
+	sh.Data[key] = obj
+	s.trackExpire(key, obj)
+	s.used.Add(obj.Memory(key))
+}
+
+// remove deletes key if it exists. Callers must hold the lock of the key's
+// shard.
+func (s *Store) remove(key string) {
+	sh := s.shard(key)
+	if obj, ok := sh.Data[key]; ok {
+		delete(sh.Data, key)
+		sh.keys.remove(key)
+		s.used.Add(-obj.Memory(key))
+	}
+}
+
+// grow accounts for delta bytes added to (or, if negative, removed from)
+// the value of obj in place. Callers must hold the lock of the key's shard.
+func (s *Store) grow(obj *Object, delta int64) {
+	obj.mem += delta
+	s.used.Add(delta)
+}
+
+// trackExpire adds key to the expires index if obj has an expiry. It must be
+// called whenever a key gets an expiry. Callers must hold the lock of the
+// key's shard.
+func (s *Store) trackExpire(key string, obj *Object) {
+	if obj.ExpireAt > 0 {
+		s.shard(key).expires[key] = struct{}{}
+	}
+}
+
+// Value types, as reported by TYPE.
+const (
+	TypeString = "string"
+	TypeList   = "list"
+	TypeStream = "stream"
+)
+
+// Object is the value stored at a key. Value is a string, a []string for
+// lists or a []StreamEntry for streams.
+type Object struct {
+	Value any
+	// ExpireAt is an absolute unix time in milliseconds, 0 for no expiry.
+	ExpireAt int64
+
+	mem      int64        // estimated size of Value, see estimate
+	accessed atomic.Int64 // unix milliseconds of the last access, for LRU
+	freq     atomic.Int64 // logarithmic access counter, for LFU
+}
+
+// init sets up the bookkeeping of an object that is about to be stored for
+// the first time.
+func (o *Object) init() {
+	if o.accessed.Load() != 0 {
+		return
+	}
+	o.mem = o.estimate()
+	o.accessed.Store(time.Now().UnixMilli())
+	o.freq.Store(lfuInitVal)
+}
+
+// Type returns the type name of the value, as reported by TYPE.
+func (o *Object) Type() string {
+	switch o.Value.(type) {
+	case string:
+		return TypeString
+	case []string:
+		return TypeList
+	case []StreamEntry:
+		return TypeStream
+	}
+	return "none"
+}
+
+// expired reports whether the object's expiry has passed.
+func (o *Object) expired(nowMs int64) bool {
+	return o.ExpireAt > 0 && nowMs > o.ExpireAt
 }
 
 type StreamEntry struct {
@@ -17,8 +206,3 @@ type StreamReadEntry struct {
 	Key     string
 	Entries []StreamEntry
 }
-
-type cacheValue struct {
-	Value string
-	Ttl   int64
-}
\ No newline at end of file
@@ -1,15 +1,28 @@
 package exchange
 
-import "sync"
+import (
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
+)
 
 type PubSub struct {
 	mu          sync.RWMutex
 	subscribers map[string][]chan string
+	patterns    map[string][]chan Message
+}
+
+// Message is a message as delivered to pattern subscribers, which need to
+// know the channel it was published to.
+type Message struct {
+	Channel string
+	Payload string
 }
 
 func NewPubSub() *PubSub {
 	return &PubSub{
 		subscribers: make(map[string][]chan string),
+		patterns:    make(map[string][]chan Message),
 	}
 }
 
@@ -27,16 +40,53 @@ func (p *PubSub) Publish(channel string, message string) int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	subscribers, ok := p.subscribers[channel]
-	if !ok {
-		return 0
-	}
-
+	subscribers := p.subscribers[channel]
 	for _, subChannel := range subscribers {
 		subChannel <- message
 	}
 
-	return len(subscribers)
+	receivers := len(subscribers)
+	for pattern, patternSubscribers := range p.patterns {
+		if !utils.StringMatch(pattern, channel, false) {
+			continue
+		}
+		for _, subChannel := range patternSubscribers {
+			subChannel <- Message{Channel: channel, Payload: message}
+		}
+		receivers += len(patternSubscribers)
+	}
+	return receivers
+}
+
+// PSubscribe subscribes to every channel matching the glob-style pattern.
+func (p *PubSub) PSubscribe(pattern string) chan Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	subChannel := make(chan Message)
+	p.patterns[pattern] = append(p.patterns[pattern], subChannel)
+	return subChannel
+}
+
+// PUnsubscribe removes a subscription made by PSubscribe and closes its
+// channel.
+func (p *PubSub) PUnsubscribe(pattern string, subChannel chan Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	subscribers := p.patterns[pattern]
+	for i, ch := range subscribers {
+		if ch == subChannel {
+			close(ch)
+			subscribers = append(subscribers[:i], subscribers[i+1:]...)
+			break
+		}
+	}
+	if len(subscribers) == 0 {
+		delete(p.patterns, pattern)
+	} else {
+		p.patterns[pattern] = subscribers
+	}
 }
 
 func (p *PubSub) Unsubscribe(channel string, subChannel chan string){
@@ -54,3 +104,23 @@ func (p *PubSub) Unsubscribe(channel string, subChannel chan string){
 		}
 	}
 }
+
+// NumChannels returns the number of channels with at least one subscriber.
+func (p *PubSub) NumChannels() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	n := 0
+	for _, subscribers := range p.subscribers {
+		if len(subscribers) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// NumPatterns returns the number of patterns with at least one subscriber.
+func (p *PubSub) NumPatterns() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.patterns)
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"log/slog"
+	"net"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/output"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+)
+
+var nextClientID atomic.Int64
+
+// client holds per-connection state negotiated by the peer.
+type client struct {
+	conn net.Conn
+	id   int64
+	name string
+	// proto is read by the pub/sub delivery goroutine, hence atomic.
+	proto atomic.Int32
+
+	// out is the only path to the socket. The command loop, pub/sub
+	// deliveries, MONITOR feeds and replication all append to it, and its
+	// writer goroutine is the only one calling conn.Write.
+	out *output.Queue
+	log *slog.Logger
+
+	// failed is set once the current command has replied with an error,
+	// for the failed_calls of INFO commandstats.
+	failed bool
+}
+
+func newClient(conn net.Conn) *client {
+	c := &client{
+		conn: conn,
+		id:   nextClientID.Add(1),
+		out:  output.New(conn),
+	}
+	c.log = logger.With("client", c.id, "addr", connAddr(conn))
+	c.proto.Store(resp.RESP2)
+	return c
+}
+
+func (c *client) protocol() int {
+	return int(c.proto.Load())
+}
+
+// encode renders v for the protocol version this client negotiated.
+func (c *client) encode(v resp.Value) []byte {
+	return resp.Encode(v, c.protocol())
+}
+
+// write queues a reply. It reaches the socket on the next flush, which the
+// command loop does once it has consumed every pipelined request.
+func (c *client) write(v resp.Value) {
+	c.out.AppendValue(v, c.protocol())
+}
+
+func (c *client) writeError(err error) {
+	replyErr := resp.ToError(err)
+	stats.RecordError(replyErr.Code)
+	c.failed = true
+	c.write(replyErr)
+}
+
+// push queues an out-of-band message and sends it immediately.
+func (c *client) push(v resp.Value) {
+	c.out.AppendValue(v, c.protocol())
+	c.out.Flush()
+}
+
+func (c *client) flush() error {
+	return c.out.Flush()
+}
+
+// close sends whatever is still queued and closes the connection.
+func (c *client) close() {
+	c.out.Close()
+}
+
+// connAddr identifies the peer the way MONITOR shows it. Unix
+// socket peers have no address of their own, so the socket path is used.
+func connAddr(conn net.Conn) string {
+	if conn.RemoteAddr().Network() == "unix" {
+		return "unix:" + conn.LocalAddr().String()
+	}
+	return conn.RemoteAddr().String()
+}
@@ -1,122 +1,216 @@
 package handlers
 
 import (
-	"fmt"
 	"net"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
 )
 
+// writeError sends err to a RESP2 connection, using the error's own code
+// when it carries one.
 func writeError(conn net.Conn, err error) {
-	errorMsg := fmt.Sprintf("-ERR%s\r\n", err.Error())
-	conn.Write([]byte(errorMsg))
+	conn.Write(resp.Encode(resp.ToError(err), resp.RESP2))
 }
 
-func handlePing(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handlePing(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("PING", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 
 	if DB.Role == "master" {
 		if len(args) == 1 {
-			return "+PONG\r\n", nil, nil
+			return resp.SimpleString("PONG"), nil, nil
 		} else {
-			response := fmt.Sprintf("$%d\r\n%s\r\n", len(args[1]), args[1])
+			response := resp.BulkString(args[1])
 			return response, nil, nil
 		}
 	}
 
-	return "", nil, nil
+	return nil, nil, nil
 }
 
-func handleEcho(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleEcho(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("ECHO", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) >= 2 {
-		response := fmt.Sprintf("$%d\r\n%s\r\n", len(args[1]), args[1])
+		response := resp.BulkString(args[1])
 		return response, nil, nil
 	} else {
-		return "$0\r\n\r\n", nil, nil
+		return resp.BulkString(""), nil, nil
 	}
 }
 
-func handleSet(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleSet(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("SET", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 3 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'SET' command")
+		return nil, nil, resp.WrongArgs("SET")
 	}
 	key := args[1]
 	value := args[2]
-	var ttlMs int64 = 0
-	if len(args) >= 5 && strings.ToUpper(args[3]) == "PX" {
-		var err error
-		ttlMs, err = strconv.ParseInt(args[4], 10, 64)
-		if err != nil {
-			return "", nil, fmt.Errorf(" invalid PX argument")
-		}
+	expireAtMs, err := parseSetExpiry(args[3:])
+	if err != nil {
+		return nil, nil, err
 	}
 
-	DB.Set(key, value, ttlMs)
+	// The key stays locked until the write is propagated, so that replicas
+	// apply the writes to it in the order the master did.
+	DB, unlock := DB.LockKeys(key)
+	defer unlock()
+	DB.Set(key, value, expireAtMs)
 	if DB.Role == "master" {
-		DB.PropagateCommand(args)
-		DB.UpdateOffset(len(utils.FormatRESPArray(args)))
-		return "+OK\r\n", nil, nil
+		// Relative TTLs are propagated as an absolute PXAT so the key expires
+		// at the same moment on replicas, regardless of replication delay.
+		propagated := []string{"SET", key, value}
+		if expireAtMs > 0 {
+			propagated = append(propagated, "PXAT", strconv.FormatInt(expireAtMs, 10))
+		}
+		DB.Propagate(propagated)
+		return resp.OK, nil, nil
 	}
-	return "", nil, nil
+	return nil, nil, nil
 }
 
-func handleGet(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+// parseSetExpiry parses the EX/PX/EXAT/PXAT options of SET and returns the
+// absolute expiry in unix milliseconds, or 0 when no expiry was given.
+func parseSetExpiry(options []string) (int64, error) {
+	var expireAtMs int64
+	for i := 0; i < len(options); i++ {
+		option := strings.ToUpper(options[i])
+		switch option {
+		case "EX", "PX", "EXAT", "PXAT":
+			if expireAtMs != 0 || i+1 >= len(options) {
+				return 0, resp.ErrSyntax
+			}
+			i++
+			n, err := strconv.ParseInt(options[i], 10, 64)
+			if err != nil {
+				return 0, resp.ErrNotInteger
+			}
+			if n <= 0 {
+				return 0, resp.NewError("invalid expire time in 'set' command")
+			}
+			switch option {
+			case "EX":
+				expireAtMs = time.Now().UnixMilli() + n*1000
+			case "PX":
+				expireAtMs = time.Now().UnixMilli() + n
+			case "EXAT":
+				expireAtMs = n * 1000
+			case "PXAT":
+				expireAtMs = n
+			}
+		default:
+			return 0, resp.ErrSyntax
+		}
+	}
+	return expireAtMs, nil
+}
+
+func handleGet(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("GET", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 2 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'GET' command")
+		return nil, nil, resp.WrongArgs("GET")
 	}
 
 	key := args[1]
-	if val, ok := DB.Get(key); ok {
-		response := fmt.Sprintf("$%d\r\n%s\r\n", len(val), val)
+	val, ok, err := DB.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		response := resp.BulkString(val)
 		return response, nil, nil
 	} else {
-		return "$-1\r\n", nil, nil
+		return resp.Null{}, nil, nil
+	}
+}
+
+func handleMGet(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("MGET", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("MGET")
+	}
+
+	values, found := DB.MGet(args[1:])
+	response := make(resp.Array, len(values))
+	for i, value := range values {
+		if found[i] {
+			response[i] = resp.BulkString(value)
+		} else {
+			response[i] = resp.Null{}
+		}
+	}
+	return response, nil, nil
+}
+
+func handleDel(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("DEL", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("DEL")
+	}
+	// A replica applies the writes of its master and rejects those of its
+	// own clients, which would otherwise go unanswered.
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+
+	DB, unlock := DB.LockKeys(args[1:]...)
+	defer unlock()
+	deleted := DB.Del(args[1:]...)
+	if DB.Role == "master" {
+		if deleted > 0 {
+			DB.Propagate(args)
+		}
+		return resp.Integer(deleted), nil, nil
 	}
+	return nil, nil, nil
 }
 
-func handleType(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleType(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("TYPE", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 2 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'GET' command")
+		return nil, nil, resp.WrongArgs("TYPE")
 	}
 	key := args[1]
 	keyType := DB.GetType(key)
-	response := fmt.Sprintf("+%s\r\n", keyType)
+	response := resp.SimpleString(keyType)
 	return response, nil, nil
 }
 
-func handleXAdd(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleXAdd(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("XADD", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 5 || len(args)%2 != 1 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'XADD' command")
+		return nil, nil, resp.WrongArgs("XADD")
 	}
 	key := args[1]
 	id := args[2]
@@ -126,41 +220,45 @@ func handleXAdd(args []string, DB *db.DB, activeTx *transaction.Transaction) (st
 		fields[args[i]] = args[i+1]
 	}
 
+	DB, unlock := DB.LockKeys(key)
+	defer unlock()
 	outPutID, err := DB.XAdd(key, id, fields)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 	if DB.Role == "master" {
-		DB.PropagateCommand(args)
-		DB.UpdateOffset(len(utils.FormatRESPArray(args)))
+		DB.Propagate(args)
 	}
-	response := fmt.Sprintf("$%d\r\n%s\r\n", len(outPutID), outPutID)
+	response := resp.BulkString(outPutID)
 	return response, nil, nil
 }
 
-func handleXRange(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleXRange(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("XRANGE", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 4 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'XRANGE' command")
+		return nil, nil, resp.WrongArgs("XRANGE")
 	}
 	key := args[1]
 	start := args[2]
 	end := args[3]
-	entries := DB.XRange(key, start, end)
+	entries, err := DB.XRange(key, start, end)
+	if err != nil {
+		return nil, nil, err
+	}
 	response := formatStreamEntries(entries)
 	return response, nil, nil
 }
 
-func handleXRead(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleXRead(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("XREAD", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 4 {
-		return "-ERR wrong number of arguments for 'XREAD' command\r\n", nil, nil
+		return nil, nil, resp.WrongArgs("XREAD")
 	}
 
 	var blockTimeout int64 = -1
@@ -169,12 +267,12 @@ func handleXRead(args []string, DB *db.DB, activeTx *transaction.Transaction) (s
 	for i, arg := range args {
 		if strings.ToUpper(arg) == "BLOCK" {
 			if i+1 >= len(args) {
-				return "-ERR BLOCK requires a timeout\r\n", nil, nil
+				return nil, nil, resp.ErrSyntax
 			}
 			var err error
 			blockTimeout, err = strconv.ParseInt(args[i+1], 10, 64)
 			if err != nil {
-				return "-ERR timeout is not an integer or out of range of 64-bit integer\r\n", nil, nil
+				return nil, nil, resp.NewError("timeout is not an integer or out of range")
 			}
 		} else if strings.ToUpper(arg) == "STREAMS" {
 			streamsIndex = i
@@ -183,7 +281,7 @@ func handleXRead(args []string, DB *db.DB, activeTx *transaction.Transaction) (s
 	}
 
 	if streamsIndex == -1 || len(args) <= streamsIndex+2 {
-		return "-ERR wrong number of arguments for 'XREAD' command\r\n", nil, nil
+		return nil, nil, resp.WrongArgs("XREAD")
 	}
 
 	numStreams := (len(args) - (streamsIndex + 1)) / 2
@@ -207,7 +305,10 @@ func handleXRead(args []string, DB *db.DB, activeTx *transaction.Transaction) (s
 		hasNewEntries = false
 		for i, key := range keys {
 			ID := IDs[i]
-			entries := DB.XREAD(key, ID)
+			entries, err := DB.XREAD(key, ID)
+			if err != nil {
+				return nil, nil, err
+			}
 			if len(entries) > 0 {
 				allEntries = append(allEntries, db.StreamReadEntry{Key: key, Entries: entries})
 				hasNewEntries = true
@@ -229,108 +330,128 @@ func handleXRead(args []string, DB *db.DB, activeTx *transaction.Transaction) (s
 	}
 
 	if !hasNewEntries {
-		return "$-1\r\n", nil, nil
+		return resp.Null{}, nil, nil
 	}
 
 	response := formatXReadResponse(allEntries)
 	return response, nil, nil
 }
 
-func handleINCR(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleINCR(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("INCR", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 2 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'INCR' command")
+		return nil, nil, resp.WrongArgs("INCR")
 	}
 	key := args[1]
-	value := DB.INCR(key)
-	if value == -1 {
-		return "", nil, fmt.Errorf(" value is not an integer or out of range")
+	DB, unlock := DB.LockKeys(key)
+	defer unlock()
+	value, err := DB.INCR(key)
+	if err != nil {
+		return nil, nil, err
 	}
 	if DB.Role == "master" {
-		DB.PropagateCommand(args)
-		DB.UpdateOffset(len(utils.FormatRESPArray(args)))
-		response := fmt.Sprintf(":%d\r\n", value)
+		DB.Propagate(args)
+		response := resp.Integer(value)
 		return response, nil, nil
 	}
-	return "", nil, nil
+	return nil, nil, nil
 
 }
 
-func handleMulti(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleMulti(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
-		return "", activeTx, fmt.Errorf(" MULTI is already active")
+		return nil, activeTx, resp.NewError("MULTI is already active")
 	}
-	return "+OK\r\n", transaction.NewTransaction(), nil
+	return resp.OK, transaction.NewTransaction(), nil
 }
 
-func handleExec(DB *db.DB, activeTx *transaction.Transaction, commandHandlers map[string]CmdHandler) (string, *transaction.Transaction, error) {
+// handleExec runs the queued commands and returns the database the
+// connection has selected afterwards, since SELECT may be queued too.
+func handleExec(DB *db.DB, activeTx *transaction.Transaction, commandHandlers map[string]CmdHandler) (resp.Value, *db.DB, *transaction.Transaction, error) {
 	if activeTx == nil {
-		return "", nil, fmt.Errorf(" EXEC without MULTI")
+		return nil, DB, nil, resp.NewError("EXEC without MULTI")
 	}
-
-	if len(activeTx.Commands) == 0 {
-		return "*0\r\n", nil, nil
+	if activeTx.Aborted() {
+		return nil, DB, nil, resp.ErrExecAbort
+	}
+	// Memory may have run out since the commands were queued.
+	for _, command := range activeTx.Commands {
+		if err := checkMaxMemory(command.Name, DB); err != nil {
+			return nil, DB, nil, err
+		}
 	}
 
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("*%d\r\n", len(activeTx.Commands)))
+	// The commands run as one: the shards of their keys stay locked until
+	// the last one is done.
+	keys, all := execKeys(DB.ID, len(DB.Databases()), activeTx.Commands)
+	DB, unlock := DB.Lock(keys, all)
+	defer unlock()
 
+	replies := make(resp.Array, 0, len(activeTx.Commands))
 	for _, command := range activeTx.Commands {
+		if command.Name == "SELECT" {
+			selected, err := selectDB(append([]string{command.Name}, command.Args...), DB)
+			if err != nil {
+				replies = append(replies, resp.ToError(err))
+			} else {
+				DB = selected
+				replies = append(replies, resp.OK)
+			}
+			continue
+		}
 		handler, ok := commandHandlers[command.Name]
 		if !ok {
-			builder.WriteString(fmt.Sprintf("-ERR unknown command '%s'\r\n", command.Name))
+			replies = append(replies, resp.NewError("unknown command '%s'", command.Name))
 			continue
 		}
 		// The activeTx is nil here because the nested commands are not part of another transaction
+		start := time.Now()
 		response, _, err := handler(append([]string{command.Name}, command.Args...), DB, nil)
+		stats.RecordCall(command.Name, time.Since(start), err != nil)
 		if err != nil {
-			builder.WriteString(fmt.Sprintf("-ERR%s\r\n", err.Error()))
-		} else {
-			builder.WriteString(response)
+			replyErr := resp.ToError(err)
+			stats.RecordError(replyErr.Code)
+			replies = append(replies, replyErr)
+		} else if response != nil {
+			replies = append(replies, response)
 		}
 	}
-	return builder.String(), nil, nil
+	return replies, DB.Unlocked(), nil, nil
 }
 
-func handleDiscard(activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleDiscard(activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx == nil {
-		return "", nil, fmt.Errorf(" DISCARD without MULTI")
+		return nil, nil, resp.NewError("DISCARD without MULTI")
 	}
 
-	return "+OK\r\n", nil, nil
+	return resp.OK, nil, nil
 }
 
-func handleInfo(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
-	var infoBuilder strings.Builder
-
-	infoBuilder.WriteString(fmt.Sprintf("role:%s\r\n", DB.Role))
-	infoBuilder.WriteString(fmt.Sprintf("master_replid:%s\r\n", DB.Replication.ID))
-	infoBuilder.WriteString(fmt.Sprintf("master_repl_offset:%d\r\n", DB.Replication.Offset))
-
-	infoString := infoBuilder.String()
-
-	return fmt.Sprintf("$%d\r\n%s\r\n", len(infoString), infoString), nil, nil
-}
-
-func handleWait(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleWait(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
-		return "", activeTx, fmt.Errorf("WAIT command is not supported inside a transaction")
+		return nil, activeTx, resp.NewError("WAIT command is not supported inside a transaction")
 	}
 	if len(args) < 3 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'WAIT' command")
+		return nil, nil, resp.WrongArgs("WAIT")
 	}
 
 	requiredAcks, err := strconv.ParseInt(args[1], 10, 64)
 	if err != nil {
-		return "", nil, fmt.Errorf("error parsing numreplicas: %w", err)
+		return nil, nil, resp.ErrNotInteger
 	}
 
 	timeOutMs, err := strconv.ParseInt(args[2], 10, 64)
 	if err != nil {
-		return "", nil, fmt.Errorf("error parsing timeout: %w", err)
+		return nil, nil, resp.NewError("timeout is not an integer or out of range")
+	}
+
+	if DB.InExec() {
+		// Like Redis, WAIT in a transaction does not block: it reports the
+		// replicas that already acknowledged every write.
+		return resp.Integer(DB.ReplicasAcked(DB.Replication.Offset.Load())), nil, nil
 	}
 
 	DB.Replication.ReplicaMu.RLock()
@@ -339,30 +460,17 @@ func handleWait(args []string, DB *db.DB, activeTx *transaction.Transaction) (st
 	copy(replicasToSignal, DB.Replication.Replicas)
 	DB.Replication.ReplicaMu.RUnlock()
 
-	fmt.Printf("WAIT: Current replication offset: %d\n", DB.Replication.Offset)
-	fmt.Printf("WAIT: Found %d replicas to signal.\n", numReplicas)
-
-	if requiredAcks <= 0 || DB.Replication.Offset == 0 || numReplicas == 0 {
-		return fmt.Sprintf(":%d\r\n", numReplicas), nil, nil
+	if requiredAcks <= 0 || DB.Replication.Offset.Load() == 0 || numReplicas == 0 {
+		return resp.Integer(numReplicas), nil, nil
 	}
 
 	atomic.StoreInt64(&DB.Replication.NumAcksRecieved, 0)
 
 	getAckCommand := []byte(utils.FormatRESPArray([]string{"REPLCONF", "GETACK", "*"}))
-	fmt.Printf("WAIT: Preparing to send GETACK command: %s", string(getAckCommand))
-
-	fmt.Printf("WAIT: Sending GETACK to %d replicas\n", len(replicasToSignal))
-	sentCount := 0
 	// This loop sends the command to ALL replicas.
-	for i, rc := range replicasToSignal {
-		rc.Mu.Lock()
-		_, err := rc.Conn.Write(getAckCommand)
-		rc.Mu.Unlock()
-		if err != nil {
-			fmt.Printf("WAIT: Failed to send GETACK to replica %d (%v): %v\n", i, rc.Conn.RemoteAddr(), err)
-		} else {
-			fmt.Printf("WAIT: Successfully sent GETACK to replica %d (%v)\n", i, rc.Conn.RemoteAddr())
-			sentCount++
+	for _, rc := range replicasToSignal {
+		if err := rc.Enqueue(getAckCommand); err != nil {
+			logger.Debug("WAIT: failed to send GETACK", "replica", rc.Conn.RemoteAddr().String(), "err", err)
 		}
 	}
 
@@ -372,246 +480,296 @@ func handleWait(args []string, DB *db.DB, activeTx *transaction.Transaction) (st
 	ticker := time.NewTicker(10 * time.Millisecond)
 	defer ticker.Stop()
 
-	fmt.Printf("WAIT: Starting wait loop for %d acks (from %d known replicas), timeout %v\n", requiredAcks, numReplicas, timeout)
+	logger.Debug("WAIT: waiting for acks", "required", requiredAcks, "replicas", numReplicas, "offset", DB.Replication.Offset.Load(), "timeout", timeout)
 
 	for {
 		select {
 		case <-ticker.C:
 			currentAcks := atomic.LoadInt64(&DB.Replication.NumAcksRecieved)
-			fmt.Printf("WAIT: Ticker check - Acks received: %d / %d\n", currentAcks, requiredAcks)
 			if currentAcks >= requiredAcks {
-				fmt.Printf("WAIT: Condition met (required): %d >= %d\n", currentAcks, requiredAcks)
-				return fmt.Sprintf(":%d\r\n", currentAcks), nil, nil
+				return resp.Integer(currentAcks), nil, nil
 			}
 		case <-timeoutChannel:
 			finalAcks := atomic.LoadInt64(&DB.Replication.NumAcksRecieved)
-			fmt.Printf("WAIT: Timeout reached. Acks received: %d\n", finalAcks)
-			return fmt.Sprintf(":%d\r\n", finalAcks), nil, nil
+			return resp.Integer(finalAcks), nil, nil
 		}
 	}
 }
 
-func handleConfig(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleConfig(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("CONFIG", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 
-	if len(args) < 3 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'CONFIG' command")
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("CONFIG")
 	}
 
-	if args[1] == "GET" {
-		subCommand := strings.ToLower(args[2])
-		switch subCommand {
-		case "dir":
-			response := utils.FormatRESPArray([]string{"dir", DB.RDBFileDir})
-			return response, nil, nil
+	switch strings.ToUpper(args[1]) {
+	case "GET":
+		if len(args) < 3 {
+			return nil, nil, resp.WrongArgs("CONFIG|GET")
+		}
+		// A parameter matched by several patterns is only reported once.
+		seen := map[string]bool{}
+		reply := resp.Map{}
+		for _, pattern := range args[2:] {
+			for _, kv := range DB.Config.Match(pattern) {
+				if seen[kv[0]] {
+					continue
+				}
+				seen[kv[0]] = true
+				reply = append(reply, resp.KeyValue{Key: resp.BulkString(kv[0]), Value: resp.BulkString(kv[1])})
+			}
+		}
+		return reply, nil, nil
 
-		case "dbfilename":
-			response := utils.FormatRESPArray([]string{"dbfilename", DB.RDBFileName})
-			return response, nil, nil
+	case "SET":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return nil, nil, resp.WrongArgs("CONFIG|SET")
+		}
+		pairs := make([][2]string, 0, (len(args)-2)/2)
+		for i := 2; i < len(args); i += 2 {
+			pairs = append(pairs, [2]string{args[i], args[i+1]})
+		}
+		if err := DB.Config.SetLive(pairs); err != nil {
+			return nil, nil, err
 		}
+		return resp.OK, nil, nil
 
-		return "", nil, fmt.Errorf(" wrong arguments for 'CONFIG' command")
-	}
-	return "", nil, fmt.Errorf(" wrong arguments for 'CONFIG' command")
+	case "REWRITE":
+		if len(args) != 2 {
+			return nil, nil, resp.WrongArgs("CONFIG|REWRITE")
+		}
+		if err := DB.Config.Rewrite(); err != nil {
+			return nil, nil, resp.NewError("%s", err.Error())
+		}
+		return resp.OK, nil, nil
+
+	case "RESETSTAT":
+		if len(args) != 2 {
+			return nil, nil, resp.WrongArgs("CONFIG|RESETSTAT")
+		}
+		DB.ResetStats()
+		return resp.OK, nil, nil
+
+	case "HELP":
+		return resp.BulkStrings([]string{
+			"CONFIG <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"GET <pattern>",
+			"    Return parameters matching the glob-like <pattern> and their values.",
+			"SET <directive> <value>",
+			"    Set the configuration <directive> to <value>.",
+			"RESETSTAT",
+			"    Reset statistics reported by the INFO command.",
+			"REWRITE",
+			"    Rewrite the configuration file.",
+			"HELP",
+			"    Print this help.",
+		}), nil, nil
+	}
+	return nil, nil, resp.NewError("unknown subcommand '%s'. Try CONFIG HELP.", args[1])
 }
 
-func handleKeys(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleKeys(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("KEYS", args[1:])
+		return resp.Queued, activeTx, nil
 	}
 
 	if len(args) < 2 {
-		return "", nil, fmt.Errorf(" wrong number of arguments for 'KEYS' command")
+		return nil, nil, resp.WrongArgs("KEYS")
 	}
 
 	pattern := args[1]
-	DB.Store.Mu.RLock()
-	defer DB.Store.Mu.RUnlock()
-
 	var matchingKeys []string
-	for key := range DB.Store.Data {
-		match, err := filepath.Match(pattern, key)
-		if err != nil {
-			return "", nil, err
-		}
-		if match {
+	for _, key := range DB.Keys() {
+		// Like Redis, a lone "*" also matches the empty key.
+		if pattern == "*" || utils.StringMatch(pattern, key, false) {
 			matchingKeys = append(matchingKeys, key)
 		}
 	}
-	response := utils.FormatRESPArray(matchingKeys)
+	response := resp.BulkStrings(matchingKeys)
 	return response, nil, nil
 }
 
-func handlePublish(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handlePublish(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("PUBLISH", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 
 	if len(args) < 3 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'PUBLISH' command")
+		return nil, nil, resp.WrongArgs("PUBLISH")
 	}
 	channel := args[1]
 	message := args[2]
 
 	subscribersCount := DB.PubSub.Publish(channel, message)
-	return fmt.Sprintf(":%d\r\n", subscribersCount), nil, nil
+	return resp.Integer(subscribersCount), nil, nil
 }
 
-func handleBlpop(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleBlpop(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
-		return "", activeTx, fmt.Errorf("BLPOP is not supported inside a transaction")
+		return nil, activeTx, resp.NewError("BLPOP is not supported inside a transaction")
 	}
 	if len(args) < 3 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'BLPOP' command")
+		return nil, nil, resp.WrongArgs("BLPOP")
 	}
 
 	key := args[1]
 	timeout, err := strconv.ParseFloat(args[2], 64)
 	if err != nil || timeout < 0 {
-		return "", nil, fmt.Errorf("timeout is not an integer or is out of range")
+		return nil, nil, resp.NewError("timeout is not an integer or is out of range")
 	}
 
-	// Check if a value is immediately available
-	poppedElements := DB.List.LPop(key, 1)
-	if poppedElements != nil {
-		response := utils.FormatRESPArray([]string{key, poppedElements[0]})
-		return response, nil, nil
+	var deadline <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(time.Duration(timeout * float64(time.Second)))
+		defer timer.Stop()
+		deadline = timer.C
 	}
 
-	// If not, block and wait
-	clientChan := make(chan string)
-	DB.List.AddBlockingClient(key, clientChan)
+	// Watch before each attempt so that a push landing between the attempt
+	// and the wait still wakes us. Another client may win the race for the
+	// pushed element, in which case we simply wait again.
+	for {
+		wake := DB.WatchList(key)
+		locked, unlock := DB.LockKeys(key)
+		poppedElements, err := locked.LPop(key, 1)
+		if err == nil && poppedElements != nil {
+			// Replicas see the pop that actually happened.
+			locked.Propagate([]string{"LPOP", key})
+		}
+		unlock()
+		if err != nil || poppedElements != nil {
+			DB.UnwatchList(key, wake)
+			if err != nil {
+				return nil, nil, err
+			}
+			response := resp.BulkStrings([]string{key, poppedElements[0]})
+			return response, nil, nil
+		}
+		if DB.InExec() {
+			// Like Redis, BLPOP in a transaction does not block: no push
+			// could reach the list before EXEC is done.
+			DB.UnwatchList(key, wake)
+			return resp.Null{}, nil, nil
+		}
 
-	if timeout == 0 {
-		<-clientChan
-		poppedElements = DB.List.LPop(key, 1)
-		response := utils.FormatRESPArray([]string{key, poppedElements[0]})
-		return response, nil, nil
-	} else {
 		select {
-		case <-clientChan:
-			poppedElements = DB.List.LPop(key, 1)
-			response := utils.FormatRESPArray([]string{key, poppedElements[0]})
-			return response, nil, nil
-		case <-time.After(time.Duration(timeout*1000) * time.Millisecond):
-			DB.List.RemoveBlockingClient(key, clientChan)
-			return "$-1\r\n", nil, nil
+		case <-wake:
+			DB.UnwatchList(key, wake)
+		case <-deadline:
+			DB.UnwatchList(key, wake)
+			return resp.Null{}, nil, nil
 		}
 	}
 }
 
-func handleRPush(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleRPush(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("RPUSH", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 3 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'RPush' command")
+		return nil, nil, resp.WrongArgs("RPUSH")
 	}
 
 	key := args[1]
 	elements := args[2:]
-	length := DB.List.RPush(key, elements)
-	response := fmt.Sprintf(":%d\r\n", length)
-	return response, nil, nil
+	DB, unlock := DB.LockKeys(key)
+	defer unlock()
+	length, err := DB.RPush(key, elements)
+	if err != nil {
+		return nil, nil, err
+	}
+	if DB.Role == "master" {
+		DB.Propagate(args)
+		response := resp.Integer(length)
+		return response, nil, nil
+	}
+	return nil, nil, nil
 }
 
-func handleLPush(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleLPush(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("LPUSH", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 3 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'LPush' command")
+		return nil, nil, resp.WrongArgs("LPUSH")
 	}
 
 	key := args[1]
 	elements := args[2:]
-	length := DB.List.LPush(key, elements)
-	response := fmt.Sprintf(":%d\r\n", length)
-	return response, nil, nil
+	DB, unlock := DB.LockKeys(key)
+	defer unlock()
+	length, err := DB.LPush(key, elements)
+	if err != nil {
+		return nil, nil, err
+	}
+	if DB.Role == "master" {
+		DB.Propagate(args)
+		response := resp.Integer(length)
+		return response, nil, nil
+	}
+	return nil, nil, nil
 }
 
-func handleLRange(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleLRange(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("LRANGE", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 4 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'LRange' command")
+		return nil, nil, resp.WrongArgs("LRANGE")
 	}
 
 	key := args[1]
-	DB.List.Mu.Lock()
-	list := DB.List.List[key]
-	DB.List.Mu.Unlock()
-	listLength := len(list)
-
 	start, err := strconv.Atoi(args[2])
 	if err != nil {
-		return "", nil, fmt.Errorf("wrong range format")
+		return nil, nil, resp.NewError("wrong range format")
 	}
 
 	end, err := strconv.Atoi((args[3]))
 	if err != nil {
-		return "", nil, fmt.Errorf("wrong range format")
+		return nil, nil, resp.NewError("wrong range format")
 	}
 
-	if start < 0 {
-		start = listLength + start
-	}
-	if end < 0 {
-		end = listLength + end
-	}
-
-	if start < 0 {
-		start = 0
-	}
-	if end >= listLength {
-		end = listLength - 1
-	}
-
-	var elements []string
-	if start <= end {
-		for i := start; i <= end; i++ {
-			elements = append(elements, list[i])
-		}
+	elements, err := DB.LRange(key, start, end)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	response := utils.FormatRESPArray(elements)
+	response := resp.BulkStrings(elements)
 	return response, nil, nil
 }
 
-func handleLLen(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleLLen(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("LLEN", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 2 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'LLEN' command")
+		return nil, nil, resp.WrongArgs("LLEN")
 	}
 	key := args[1]
-	DB.List.Mu.Lock()
-	defer DB.List.Mu.Unlock()
-	if _, ok := DB.List.List[key]; !ok {
-		return ":0\r\n", nil, nil
+	length, err := DB.LLen(key)
+	if err != nil {
+		return nil, nil, err
 	}
-
-	response := fmt.Sprintf(":%d\r\n", len(DB.List.List[key]))
+	response := resp.Integer(length)
 	return response, nil, nil
 }
 
-func handleLPop(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error) {
+func handleLPop(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
 	if activeTx != nil {
 		activeTx.AddCommand("LPOP", args[1:])
-		return "+QUEUED\r\n", activeTx, nil
+		return resp.Queued, activeTx, nil
 	}
 	if len(args) < 2 {
-		return "", nil, fmt.Errorf("wrong number of arguments for 'LPOP' command")
+		return nil, nil, resp.WrongArgs("LPOP")
 	}
 
 	key := args[1]
@@ -620,18 +778,29 @@ func handleLPop(args []string, DB *db.DB, activeTx *transaction.Transaction) (st
 		var err error
 		count, err = strconv.Atoi(args[2])
 		if err != nil || count < 0 {
-			return "", nil, fmt.Errorf("value is not an integer or is out of range")
+			return nil, nil, resp.NewError("value is not an integer or is out of range")
 		}
 	}
 
-	poppedElements := DB.List.LPop(key, count)
+	DB, unlock := DB.LockKeys(key)
+	defer unlock()
+	poppedElements, err := DB.LPop(key, count)
+	if err != nil {
+		return nil, nil, err
+	}
+	if DB.Role != "master" {
+		return nil, nil, nil
+	}
+	if len(poppedElements) > 0 {
+		DB.Propagate(args)
+	}
 	if poppedElements == nil {
-		return "$-1\r\n", nil, nil
+		return resp.Null{}, nil, nil
 	}
 	if len(poppedElements) == 1 {
-		response := fmt.Sprintf("$%d\r\n%s\r\n", len(poppedElements[0]), poppedElements[0])
+		response := resp.BulkString(poppedElements[0])
 		return response, nil, nil
 	}
-	response := utils.FormatRESPArray(poppedElements)
+	response := resp.BulkStrings(poppedElements)
 	return response, nil, nil
 }
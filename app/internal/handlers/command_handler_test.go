@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/output"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+)
+
+// Clients writing the same keys at once must reach the replicas in the
+// order the master applied their writes, or the replicas end up with other
+// values. Run with -race, on several CPUs.
+func TestConcurrentWritesReplicateInOrder(t *testing.T) {
+	master := db.New("master", 16)
+	replica := db.New("slave", 16)
+	stream, replicaConn := net.Pipe()
+	master.AddReplica(stream, output.New(stream))
+
+	// Apply the stream as the replica would, up to the PING propagated
+	// once the writers are done.
+	applied := make(chan struct{})
+	go func() {
+		defer close(applied)
+		r := resp.NewReader(replicaConn)
+		DB := replica.MasterStream()
+		for {
+			args, err := r.ReadCommand()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			switch args[0] {
+			case "PING":
+				return
+			case "SELECT":
+				DB, _ = selectDB(args, DB)
+			default:
+				if _, _, err := commandHandlers[args[0]](args, DB, nil); err != nil {
+					t.Errorf("%q: %v", args, err)
+				}
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				value := fmt.Sprintf("%d:%d", w, i)
+				for _, args := range [][]string{
+					{"LPUSH", "list", value},
+					{"RPUSH", "list", value},
+					{"LPOP", "list"},
+					{"SET", "counter", fmt.Sprint(i)},
+					{"INCR", "counter"},
+				} {
+					if _, _, err := commandHandlers[args[0]](args, master, nil); err != nil {
+						t.Errorf("%q: %v", args, err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	master.Propagate([]string{"PING"})
+	<-applied
+	replicaConn.Close()
+
+	for _, args := range [][]string{{"LRANGE", "list", "0", "-1"}, {"GET", "counter"}} {
+		onMaster, _, _ := commandHandlers[args[0]](args, master, nil)
+		onReplica, _, _ := commandHandlers[args[0]](args, replica, nil)
+		if !reflect.DeepEqual(onMaster, onReplica) {
+			t.Errorf("%q differs between the replica and the master", args)
+		}
+	}
+}
+
+// keyspace describes the keys of DB and their expiry.
+func keyspace(DB *db.DB) string {
+	keys := DB.Keys()
+	slices.Sort(keys)
+	var desc []string
+	for _, key := range keys {
+		desc = append(desc, fmt.Sprintf("%s@%d", key, DB.ExpireTime(key)))
+	}
+	return fmt.Sprint(desc)
+}
+
+// A replica rejects the writes of its own clients, and applies those of its
+// master without answering them.
+func TestReplicaWrites(t *testing.T) {
+	for _, args := range [][]string{
+		{"DEL", "a"},
+		{"UNLINK", "a"},
+		{"RENAME", "a", "b"},
+		{"RENAMENX", "a", "b"},
+		{"COPY", "a", "b"},
+		{"EXPIRE", "a", "100"},
+		{"PEXPIRE", "a", "100000"},
+		{"EXPIREAT", "a", "4000000000"},
+		{"PEXPIREAT", "a", "4000000000000"},
+		{"PERSIST", "a"},
+		{"MOVE", "a", "1"},
+		{"SWAPDB", "0", "1"},
+		{"FLUSHDB"},
+		{"FLUSHALL", "ASYNC"},
+	} {
+		replica := db.New("slave", 16)
+		replica.Set("a", "1", time.Now().Add(time.Hour).UnixMilli())
+		before := keyspace(replica)
+
+		if _, _, err := commandHandlers[args[0]](args, replica, nil); !errors.Is(err, resp.ErrReadOnly) {
+			t.Errorf("%q from a client: %v, want READONLY", args, err)
+		}
+		if after := keyspace(replica); after != before {
+			t.Errorf("%q from a client changed %s to %s", args, before, after)
+		}
+
+		reply, _, err := commandHandlers[args[0]](args, replica.MasterStream(), nil)
+		if reply != nil || err != nil {
+			t.Errorf("%q from the master: %v, %v; want no reply", args, reply, err)
+		}
+		if keyspace(replica) == before {
+			t.Errorf("%q from the master was not applied", args)
+		}
+	}
+}
+
+// newTypedDB returns a database with a key of each type.
+func newTypedDB(t *testing.T) *db.DB {
+	t.Helper()
+	DB := db.New("master", 16)
+	DB.Set("string", "value", 0)
+	DB.RPush("list", []string{"a"})
+	if _, err := DB.XAdd("stream", "1-1", map[string]string{"field": "value"}); err != nil {
+		t.Fatal(err)
+	}
+	return DB
+}
+
+// Every command that reads or changes a value of one type replies WRONGTYPE
+// on a key of another, and leaves the key as it was.
+func TestWrongType(t *testing.T) {
+	for _, args := range [][]string{
+		{"GET", "list"},
+		{"INCR", "list"},
+		{"INCR", "stream"},
+		{"RPUSH", "string", "a"},
+		{"LPUSH", "stream", "a"},
+		{"LRANGE", "string", "0", "-1"},
+		{"LLEN", "stream"},
+		{"LPOP", "string"},
+		{"BLPOP", "string", "0"},
+		{"XADD", "string", "*", "field", "value"},
+		{"XADD", "list", "*", "field", "value"},
+		{"XRANGE", "list", "-", "+"},
+	} {
+		DB := newTypedDB(t)
+		before := keyspace(DB)
+		reply, _, err := commandHandlers[args[0]](args, DB, nil)
+		if !errors.Is(err, resp.ErrWrongType) {
+			t.Errorf("%q: %v, %v; want WRONGTYPE", args, reply, err)
+		}
+		if after := keyspace(DB); after != before {
+			t.Errorf("%q changed %s to %s", args, before, after)
+		}
+	}
+
+	// MGET replies nil for a key of another type instead.
+	args := []string{"MGET", "string", "list", "stream"}
+	reply, _, err := commandHandlers["MGET"](args, newTypedDB(t), nil)
+	if want := (resp.Array{resp.BulkString("value"), resp.Null{}, resp.Null{}}); err != nil || !reflect.DeepEqual(reply, want) {
+		t.Errorf("%q: %v, %v; want %v", args, reply, err, want)
+	}
+}
+
+// TYPE reports the type of every key, in the one keyspace they share.
+func TestType(t *testing.T) {
+	DB := newTypedDB(t)
+	for key, want := range map[string]string{"string": "string", "list": "list", "stream": "stream", "missing": "none"} {
+		reply, _, err := commandHandlers["TYPE"]([]string{"TYPE", key}, DB, nil)
+		if err != nil || !reflect.DeepEqual(reply, resp.SimpleString(want)) {
+			t.Errorf("TYPE %s: %v, %v; want %s", key, reply, err, want)
+		}
+	}
+}
+
+func TestIncr(t *testing.T) {
+	tests := []struct {
+		value string // "" for a missing key
+		want  resp.Value
+		err   error
+	}{
+		{"", resp.Integer(1), nil},
+		{"41", resp.Integer(42), nil},
+		{"-1", resp.Integer(0), nil},
+		{fmt.Sprint(math.MaxInt64 - 1), resp.Integer(math.MaxInt64), nil},
+		{fmt.Sprint(int64(math.MaxInt64)), nil, resp.ErrOverflow},
+		{"9223372036854775808", nil, resp.ErrNotInteger},
+		{"1.5", nil, resp.ErrNotInteger},
+		{" 1", nil, resp.ErrNotInteger},
+		{"abc", nil, resp.ErrNotInteger},
+	}
+	for _, tt := range tests {
+		DB := db.New("master", 16)
+		if tt.value != "" {
+			DB.Set("counter", tt.value, 0)
+		}
+		reply, _, err := commandHandlers["INCR"]([]string{"INCR", "counter"}, DB, nil)
+		if !reflect.DeepEqual(reply, tt.want) || !errors.Is(err, tt.err) {
+			t.Errorf("INCR of %q: %v, %v; want %v, %v", tt.value, reply, err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+)
+
+// selectDB implements SELECT index for the connection, the EXEC of a
+// transaction and the master link, which each keep track of their own
+// database.
+func selectDB(args []string, DB *db.DB) (*db.DB, error) {
+	if len(args) != 2 {
+		return nil, resp.WrongArgs("SELECT")
+	}
+	id, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, resp.ErrNotInteger
+	}
+	return DB.Select(id)
+}
+
+// parseDBIndex parses the index of another database, as taken by MOVE and
+// COPY.
+func parseDBIndex(arg string, DB *db.DB) (*db.DB, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil {
+		return nil, resp.ErrNotInteger
+	}
+	return DB.Select(id)
+}
+
+func handleMove(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("MOVE", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 3 {
+		return nil, nil, resp.WrongArgs("MOVE")
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+	to, err := parseDBIndex(args[2], DB)
+	if err != nil {
+		return nil, nil, err
+	}
+	if to.ID == DB.ID {
+		return nil, nil, resp.NewError("source and destination objects are the same")
+	}
+
+	// The destination is looked up again through the locked view.
+	DB, unlock := DB.Lock([]db.KeyRef{{DB: DB.ID, Key: args[1]}, {DB: to.ID, Key: args[1]}}, false)
+	defer unlock()
+	to, _ = DB.Select(to.ID)
+	moved := DB.Move(args[1], to)
+	if DB.Role != "master" {
+		return nil, nil, nil
+	}
+	if !moved {
+		return resp.Integer(0), nil, nil
+	}
+	DB.Propagate(args)
+	return resp.Integer(1), nil, nil
+}
+
+func handleSwapDB(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("SWAPDB", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 3 {
+		return nil, nil, resp.WrongArgs("SWAPDB")
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+	first, err := strconv.Atoi(args[1])
+	if err != nil {
+		return nil, nil, resp.NewError("invalid first DB index")
+	}
+	second, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, nil, resp.NewError("invalid second DB index")
+	}
+	DB, unlock := DB.Lock(nil, true)
+	defer unlock()
+	a, err := DB.Select(first)
+	if err != nil {
+		return nil, nil, err
+	}
+	b, err := DB.Select(second)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	a.SwapDB(b)
+	if DB.Role == "master" {
+		DB.Propagate(args)
+		return resp.OK, nil, nil
+	}
+	return nil, nil, nil
+}
+
+func handleFlushDB(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return flushGeneric("FLUSHDB", args, DB, activeTx)
+}
+
+func handleFlushAll(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return flushGeneric("FLUSHALL", args, DB, activeTx)
+}
+
+// flushGeneric implements FLUSHDB and FLUSHALL [ASYNC | SYNC]. Dropping the
+// maps leaves freeing the values to the garbage collector either way, so
+// both modes return at once.
+func flushGeneric(name string, args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand(name, args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) > 2 {
+		return nil, nil, resp.WrongArgs(name)
+	}
+	if len(args) == 2 && !strings.EqualFold(args[1], "ASYNC") && !strings.EqualFold(args[1], "SYNC") {
+		return nil, nil, resp.ErrSyntax
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+
+	DB, unlock := DB.Lock(nil, true)
+	defer unlock()
+	if name == "FLUSHALL" {
+		DB.FlushAll()
+	} else {
+		DB.Flush()
+	}
+	if DB.Role == "master" {
+		DB.Propagate(args)
+		return resp.OK, nil, nil
+	}
+	return nil, nil, nil
+}
+
+func handleDBSize(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("DBSIZE", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 1 {
+		return nil, nil, resp.WrongArgs("DBSIZE")
+	}
+	return resp.Integer(DB.Size()), nil, nil
+}
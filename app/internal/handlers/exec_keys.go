@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+)
+
+// keySpec locates the keys among the arguments of a command, counting the
+// command name as argument 0, like the key specs of Redis' COMMAND: from
+// first to last, every step arguments. A negative last counts from the end.
+// A zero spec means the command takes no keys.
+type keySpec struct {
+	first, last, step int
+}
+
+// keySpecs covers the commands EXEC can lock just the keys of. Commands
+// that are not listed, such as KEYS, FLUSHALL or INFO, may touch any key,
+// and a transaction queuing one of them locks the whole keyspace.
+var keySpecs = map[string]keySpec{
+	"PING":        {},
+	"ECHO":        {},
+	"PUBLISH":     {},
+	"LASTSAVE":    {},
+	"SET":         {1, 1, 1},
+	"GET":         {1, 1, 1},
+	"MGET":        {1, -1, 1},
+	"DEL":         {1, -1, 1},
+	"UNLINK":      {1, -1, 1},
+	"EXISTS":      {1, -1, 1},
+	"TOUCH":       {1, -1, 1},
+	"TYPE":        {1, 1, 1},
+	"INCR":        {1, 1, 1},
+	"XADD":        {1, 1, 1},
+	"XRANGE":      {1, 1, 1},
+	"RPUSH":       {1, 1, 1},
+	"LPUSH":       {1, 1, 1},
+	"LRANGE":      {1, 1, 1},
+	"LLEN":        {1, 1, 1},
+	"LPOP":        {1, 1, 1},
+	"BLPOP":       {1, -2, 1},
+	"WAIT":        {},
+	"RENAME":      {1, 2, 1},
+	"RENAMENX":    {1, 2, 1},
+	"COPY":        {1, 2, 1},
+	"MOVE":        {1, 1, 1},
+	"EXPIRE":      {1, 1, 1},
+	"PEXPIRE":     {1, 1, 1},
+	"EXPIREAT":    {1, 1, 1},
+	"PEXPIREAT":   {1, 1, 1},
+	"TTL":         {1, 1, 1},
+	"PTTL":        {1, 1, 1},
+	"EXPIRETIME":  {1, 1, 1},
+	"PEXPIRETIME": {1, 1, 1},
+	"PERSIST":     {1, 1, 1},
+	"OBJECT":      {2, 2, 1},
+}
+
+// execKeys returns the keys the queued commands of a transaction touch,
+// starting in database id of databases, or all if one of them may touch any
+// key. Keys that malformed commands would name are of no concern: those
+// commands fail without touching anything.
+func execKeys(id, databases int, commands []transaction.CommandQueue) (keys []db.KeyRef, all bool) {
+	for _, command := range commands {
+		args := append([]string{command.Name}, command.Args...)
+		switch command.Name {
+		case "SELECT":
+			if len(args) == 2 {
+				// A SELECT out of range fails, and the commands after it
+				// stay in the current database.
+				if n, err := strconv.Atoi(args[1]); err == nil && n >= 0 && n < databases {
+					id = n
+				}
+			}
+			continue
+		case "MOVE":
+			// The key is looked up in the target database too.
+			if len(args) == 3 {
+				if n, err := strconv.Atoi(args[2]); err == nil {
+					keys = append(keys, db.KeyRef{DB: n, Key: args[1]})
+				}
+			}
+		case "COPY":
+			// DB n puts the destination in another database.
+			for i := 3; i+1 < len(args); i++ {
+				if strings.EqualFold(args[i], "DB") {
+					if n, err := strconv.Atoi(args[i+1]); err == nil && len(args) > 2 {
+						keys = append(keys, db.KeyRef{DB: n, Key: args[2]})
+					}
+				}
+			}
+		case "MEMORY":
+			if len(args) >= 3 && strings.EqualFold(args[1], "USAGE") {
+				keys = append(keys, db.KeyRef{DB: id, Key: args[2]})
+				continue
+			}
+		}
+
+		spec, ok := keySpecs[command.Name]
+		if !ok {
+			return nil, true
+		}
+		if spec.step == 0 {
+			continue
+		}
+		last := spec.last
+		if last < 0 {
+			last += len(args)
+		}
+		for i := spec.first; i <= last && i < len(args); i += spec.step {
+			keys = append(keys, db.KeyRef{DB: id, Key: args[i]})
+		}
+	}
+	return keys, false
+}
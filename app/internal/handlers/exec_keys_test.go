@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+)
+
+func TestExecKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands [][]string
+		keys     []db.KeyRef
+		all      bool
+	}{
+		{"keyless", [][]string{{"PING"}, {"WAIT", "1", "0"}}, nil, false},
+		{"one key", [][]string{{"SET", "a", "1"}, {"GET", "b"}}, []db.KeyRef{{DB: 0, Key: "a"}, {DB: 0, Key: "b"}}, false},
+		{"every key but the last", [][]string{{"BLPOP", "a", "b", "0"}}, []db.KeyRef{{DB: 0, Key: "a"}, {DB: 0, Key: "b"}}, false},
+		{"select", [][]string{{"SELECT", "3"}, {"GET", "a"}}, []db.KeyRef{{DB: 3, Key: "a"}}, false},
+		{"select out of range", [][]string{{"SELECT", "16"}, {"GET", "a"}, {"SELECT", "-1"}, {"GET", "b"}}, []db.KeyRef{{DB: 0, Key: "a"}, {DB: 0, Key: "b"}}, false},
+		{"move", [][]string{{"MOVE", "a", "2"}}, []db.KeyRef{{DB: 2, Key: "a"}, {DB: 0, Key: "a"}}, false},
+		{"any key", [][]string{{"SET", "a", "1"}, {"FLUSHALL"}}, nil, true},
+	}
+	for _, tt := range tests {
+		commands := make([]transaction.CommandQueue, len(tt.commands))
+		for i, args := range tt.commands {
+			commands[i] = transaction.CommandQueue{Name: args[0], Args: args[1:]}
+		}
+		keys, all := execKeys(0, 16, commands)
+		if !reflect.DeepEqual(keys, tt.keys) || all != tt.all {
+			t.Errorf("%s: execKeys = %v, %v; want %v, %v", tt.name, keys, all, tt.keys, tt.all)
+		}
+	}
+}
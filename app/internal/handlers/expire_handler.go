@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+)
+
+// expireCommand describes how one of EXPIRE, PEXPIRE, EXPIREAT and
+// PEXPIREAT interprets its time argument.
+type expireCommand struct {
+	name     string
+	unit     int64 // milliseconds per unit of the argument
+	absolute bool
+}
+
+func handleExpire(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return expireGeneric(expireCommand{"EXPIRE", 1000, false}, args, DB, activeTx)
+}
+
+func handlePExpire(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return expireGeneric(expireCommand{"PEXPIRE", 1, false}, args, DB, activeTx)
+}
+
+func handleExpireAt(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return expireGeneric(expireCommand{"EXPIREAT", 1000, true}, args, DB, activeTx)
+}
+
+func handlePExpireAt(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return expireGeneric(expireCommand{"PEXPIREAT", 1, true}, args, DB, activeTx)
+}
+
+// expireGeneric implements <command> key time [NX | XX | GT | LT]. Like SET,
+// the expiry reaches replicas as an absolute PEXPIREAT; an expiry in the
+// past deletes the key, which DB.Expire propagates as a DEL.
+func expireGeneric(cmd expireCommand, args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand(cmd.name, args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 3 {
+		return nil, nil, resp.WrongArgs(cmd.name)
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+	key := args[1]
+	n, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return nil, nil, resp.ErrNotInteger
+	}
+
+	var nx, xx, gt, lt bool
+	for _, option := range args[3:] {
+		switch strings.ToUpper(option) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "GT":
+			gt = true
+		case "LT":
+			lt = true
+		default:
+			return nil, nil, resp.NewError("Unsupported option %s", option)
+		}
+	}
+	if nx && (xx || gt || lt) {
+		return nil, nil, resp.NewError("NX and XX, GT or LT options at the same time are not compatible")
+	}
+	if gt && lt {
+		return nil, nil, resp.NewError("GT and LT options at the same time are not compatible")
+	}
+	condition := ""
+	switch {
+	case nx:
+		condition = "NX"
+	case xx:
+		condition = "XX"
+	case gt:
+		condition = "GT"
+	case lt:
+		condition = "LT"
+	}
+
+	invalid := resp.NewError("invalid expire time in '%s' command", strings.ToLower(cmd.name))
+	if n > math.MaxInt64/cmd.unit || n < math.MinInt64/cmd.unit {
+		return nil, nil, invalid
+	}
+	atMs := n * cmd.unit
+	if !cmd.absolute {
+		now := time.Now().UnixMilli()
+		if atMs > math.MaxInt64-now {
+			return nil, nil, invalid
+		}
+		atMs += now
+	}
+
+	DB, unlock := DB.LockKeys(key)
+	defer unlock()
+	set, deleted := DB.Expire(key, atMs, condition)
+	if DB.Role != "master" {
+		return nil, nil, nil
+	}
+	if !set {
+		return resp.Integer(0), nil, nil
+	}
+	if !deleted {
+		DB.Propagate([]string{"PEXPIREAT", key, strconv.FormatInt(atMs, 10)})
+	}
+	return resp.Integer(1), nil, nil
+}
+
+func handleTTL(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return ttlGeneric("TTL", args, DB, activeTx)
+}
+
+func handlePTTL(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return ttlGeneric("PTTL", args, DB, activeTx)
+}
+
+func handleExpireTime(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return ttlGeneric("EXPIRETIME", args, DB, activeTx)
+}
+
+func handlePExpireTime(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	return ttlGeneric("PEXPIRETIME", args, DB, activeTx)
+}
+
+// ttlGeneric implements TTL, PTTL, EXPIRETIME and PEXPIRETIME: -2 for a
+// missing key, -1 for a key without expiry, otherwise the remaining time or
+// the absolute expiry.
+func ttlGeneric(name string, args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand(name, args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 2 {
+		return nil, nil, resp.WrongArgs(name)
+	}
+
+	atMs := DB.ExpireTime(args[1])
+	if atMs < 0 {
+		return resp.Integer(atMs), nil, nil
+	}
+	switch name {
+	case "TTL":
+		remaining := max(atMs-time.Now().UnixMilli(), 0)
+		return resp.Integer((remaining + 500) / 1000), nil, nil
+	case "PTTL":
+		return resp.Integer(max(atMs-time.Now().UnixMilli(), 0)), nil, nil
+	case "EXPIRETIME":
+		return resp.Integer(atMs / 1000), nil, nil
+	}
+	return resp.Integer(atMs), nil, nil
+}
+
+func handlePersist(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("PERSIST", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 2 {
+		return nil, nil, resp.WrongArgs("PERSIST")
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+
+	DB, unlock := DB.LockKeys(args[1])
+	defer unlock()
+	persisted := DB.Persist(args[1])
+	if DB.Role != "master" {
+		return nil, nil, nil
+	}
+	if !persisted {
+		return resp.Integer(0), nil, nil
+	}
+	DB.Propagate(args)
+	return resp.Integer(1), nil, nil
+}
@@ -1,38 +1,30 @@
 package handlers
 
 import (
-	"fmt"
-	"strings"
-
 	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
 )
 
-func formatStreamEntries(entries []db.StreamEntry) string {
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("*%d\r\n", len(entries)))
+func formatStreamEntries(entries []db.StreamEntry) resp.Array {
+	reply := make(resp.Array, 0, len(entries))
 
 	for _, entry := range entries {
 		// Array for each entry: [ID, [field1, value1, field2, value2]]
-		builder.WriteString(fmt.Sprintf("*2\r\n$%d\r\n%s\r\n", len(entry.ID), entry.ID))
-		builder.WriteString(fmt.Sprintf("*%d\r\n", len(entry.Fields)*2))
-
+		fields := make(resp.Array, 0, len(entry.Fields)*2)
 		for key, value := range entry.Fields {
-			builder.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(key), key))
-			builder.WriteString(fmt.Sprintf("$%d\r\n%s\r\n", len(value), value))
+			fields = append(fields, resp.BulkString(key), resp.BulkString(value))
 		}
+		reply = append(reply, resp.Array{resp.BulkString(entry.ID), fields})
 	}
 
-	return builder.String()
+	return reply
 }
 
-func formatXReadResponse(allEntries []db.StreamReadEntry) string {
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("*%d\r\n", len(allEntries)))
+func formatXReadResponse(allEntries []db.StreamReadEntry) resp.Array {
+	reply := make(resp.Array, 0, len(allEntries))
 
 	for _, streamEntry := range allEntries {
-		builder.WriteString(fmt.Sprintf("*2\r\n$%d\r\n%s\r\n", len(streamEntry.Key), streamEntry.Key))
-		builder.WriteString(formatStreamEntries(streamEntry.Entries))
+		reply = append(reply, resp.Array{resp.BulkString(streamEntry.Key), formatStreamEntries(streamEntry.Entries)})
 	}
-	return builder.String()
+	return reply
 }
-
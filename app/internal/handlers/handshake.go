@@ -6,6 +6,8 @@ import (
 	"io"
 	"net"
 	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
 )
 
 func sendAndReceiveOK(conn net.Conn, reader *bufio.Reader, command string) error {
@@ -87,6 +89,6 @@ func HandshakeWithMaster(conn net.Conn, reader *bufio.Reader, port string) error
 		return fmt.Errorf("failed to read RDB file content: %w", err)
 	}
 
-	fmt.Println("Handshake with master successful.")
+	logger.Notice("MASTER <-> REPLICA sync: Finished with success", "master", conn.RemoteAddr().String())
 	return nil
 }
\ No newline at end of file
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+)
+
+const serverVersion = "7.2.0"
+
+// handleHello implements HELLO [protover [AUTH username password] [SETNAME clientname]].
+// Nothing is changed unless every option is valid.
+func handleHello(args []string, DB *db.DB, c *client) (resp.Value, error) {
+	proto := c.protocol()
+	name := c.name
+
+	if len(args) > 1 {
+		ver, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return nil, resp.NewError("Protocol version is not an integer or out of range")
+		}
+		if ver != resp.RESP2 && ver != resp.RESP3 {
+			return nil, resp.NewCodeError("NOPROTO", "unsupported protocol version")
+		}
+		proto = int(ver)
+	}
+
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch {
+		case option == "AUTH" && i+2 < len(args):
+			// There is no ACL support: only the passwordless default user exists.
+			if args[i+1] != "default" {
+				return nil, resp.NewCodeError("WRONGPASS", "invalid username-password pair or user is disabled.")
+			}
+			i += 2
+		case option == "SETNAME" && i+1 < len(args):
+			if !validClientName(args[i+1]) {
+				return nil, resp.NewError("Client names cannot contain spaces, newlines or special characters.")
+			}
+			name = args[i+1]
+			i++
+		default:
+			return nil, resp.NewError("Syntax error in HELLO option '%s'", args[i])
+		}
+	}
+
+	c.proto.Store(int32(proto))
+	c.name = name
+
+	role := "master"
+	if DB.Role != "master" {
+		role = "replica"
+	}
+	reply := resp.Map{
+		{Key: resp.BulkString("server"), Value: resp.BulkString("redis")},
+		{Key: resp.BulkString("version"), Value: resp.BulkString(serverVersion)},
+		{Key: resp.BulkString("proto"), Value: resp.Integer(proto)},
+		{Key: resp.BulkString("id"), Value: resp.Integer(c.id)},
+		{Key: resp.BulkString("mode"), Value: resp.BulkString("standalone")},
+		{Key: resp.BulkString("role"), Value: resp.BulkString(role)},
+		{Key: resp.BulkString("modules"), Value: resp.Array{}},
+	}
+	return reply, nil
+}
+
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
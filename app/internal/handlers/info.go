@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
+)
+
+// infoSection writes the fields of one INFO section.
+type infoSection struct {
+	name  string
+	title string
+	// inDefault marks the sections shown by a plain INFO.
+	inDefault bool
+	write     func(b *strings.Builder, DB *db.DB)
+}
+
+// infoSections are listed in the order Redis prints them.
+var infoSections = []infoSection{
+	{"server", "Server", true, infoServer},
+	{"clients", "Clients", true, infoClients},
+	{"memory", "Memory", true, infoMemory},
+	{"persistence", "Persistence", true, infoPersistence},
+	{"stats", "Stats", true, infoStats},
+	{"replication", "Replication", true, infoReplication},
+	{"cpu", "CPU", true, infoCPU},
+	{"commandstats", "Commandstats", false, infoCommandStats},
+	{"errorstats", "Errorstats", true, infoErrorStats},
+	{"keyspace", "Keyspace", true, infoKeyspace},
+}
+
+// runID identifies this process, as opposed to the replication ID which a
+// replica takes over from its master.
+var runID = utils.GenerateReplicaID()
+
+func handleInfo(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("INFO", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+
+	// Like Redis: no argument or "default" gives the default sections,
+	// "all" and "everything" give every section, and unknown section
+	// names are ignored.
+	wanted := map[string]bool{}
+	all, defaults := false, len(args) < 2
+	for _, arg := range args[1:] {
+		switch name := strings.ToLower(arg); name {
+		case "all", "everything":
+			all = true
+		case "default":
+			defaults = true
+		default:
+			wanted[name] = true
+		}
+	}
+
+	var b strings.Builder
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] && !(defaults && section.inDefault) {
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + section.title + "\r\n")
+		section.write(&b, DB)
+	}
+	return resp.Verbatim{Format: "txt", Text: b.String()}, nil, nil
+}
+
+func infoField(b *strings.Builder, name string, value any) {
+	fmt.Fprintf(b, "%s:%v\r\n", name, value)
+}
+
+func infoServer(b *strings.Builder, DB *db.DB) {
+	uptime := int64(time.Since(stats.StartTime).Seconds())
+	executable, _ := os.Executable()
+
+	infoField(b, "redis_version", serverVersion)
+	infoField(b, "redis_mode", "standalone")
+	infoField(b, "os", runtime.GOOS+" "+runtime.GOARCH)
+	infoField(b, "arch_bits", strconv.IntSize)
+	infoField(b, "go_version", runtime.Version())
+	infoField(b, "process_id", os.Getpid())
+	infoField(b, "run_id", runID)
+	infoField(b, "tcp_port", DB.Config.Get("port"))
+	infoField(b, "server_time_usec", time.Now().UnixMicro())
+	infoField(b, "uptime_in_seconds", uptime)
+	infoField(b, "uptime_in_days", uptime/86400)
+	infoField(b, "hz", DB.Hz())
+	infoField(b, "executable", executable)
+	infoField(b, "config_file", DB.Config.File())
+}
+
+func infoClients(b *strings.Builder, DB *db.DB) {
+	infoField(b, "connected_clients", connectedClients.Load())
+	infoField(b, "maxclients", maxClients.Load())
+	infoField(b, "blocked_clients", blockedClients.Load())
+	infoField(b, "pubsub_clients", pubsubClients.Load())
+	infoField(b, "monitor_clients", monitors.count.Load())
+}
+
+func infoMemory(b *strings.Builder, DB *db.DB) {
+	used, sys, peak := stats.Memory()
+	infoField(b, "used_memory", used)
+	infoField(b, "used_memory_human", bytesToHuman(used))
+	infoField(b, "used_memory_rss", sys)
+	infoField(b, "used_memory_rss_human", bytesToHuman(sys))
+	infoField(b, "used_memory_peak", peak)
+	infoField(b, "used_memory_peak_human", bytesToHuman(peak))
+	// The estimate of the keys alone, which is what maxmemory limits.
+	infoField(b, "used_memory_dataset", DB.UsedMemory())
+	maxMemory := DB.MaxMemory()
+	infoField(b, "maxmemory", maxMemory)
+	infoField(b, "maxmemory_human", bytesToHuman(uint64(maxMemory)))
+	infoField(b, "maxmemory_policy", DB.EvictionPolicy())
+	infoField(b, "mem_fragmentation_ratio", fmt.Sprintf("%.2f", float64(sys)/float64(max(used, 1))))
+	infoField(b, "mem_allocator", "go-"+runtime.Version())
+}
+
+func infoPersistence(b *strings.Builder, DB *db.DB) {
+	infoField(b, "loading", 0)
+	bgsave := 0
+	if DB.Saving() {
+		bgsave = 1
+	}
+	infoField(b, "rdb_bgsave_in_progress", bgsave)
+	infoField(b, "rdb_last_save_time", DB.LastSave())
+	lastStatus := "ok"
+	if !DB.LastSaveOK() {
+		lastStatus = "err"
+	}
+	infoField(b, "rdb_last_bgsave_status", lastStatus)
+	infoField(b, "aof_enabled", 0)
+	infoField(b, "aof_rewrite_in_progress", 0)
+}
+
+func infoStats(b *strings.Builder, DB *db.DB) {
+	infoField(b, "total_connections_received", stats.ConnectionsReceived.Load())
+	infoField(b, "total_commands_processed", stats.CommandsProcessed.Load())
+	infoField(b, "total_net_input_bytes", stats.NetInputBytes.Load())
+	infoField(b, "total_net_output_bytes", stats.NetOutputBytes.Load())
+	infoField(b, "rejected_connections", stats.RejectedConnections.Load())
+	infoField(b, "expired_keys", stats.ExpiredKeys.Load())
+	infoField(b, "evicted_keys", stats.EvictedKeys.Load())
+	infoField(b, "keyspace_hits", stats.KeyspaceHits.Load())
+	infoField(b, "keyspace_misses", stats.KeyspaceMisses.Load())
+	infoField(b, "pubsub_channels", DB.PubSub.NumChannels())
+	infoField(b, "pubsub_patterns", DB.PubSub.NumPatterns())
+	infoField(b, "total_error_replies", stats.ErrorReplies.Load())
+}
+
+func infoReplication(b *strings.Builder, DB *db.DB) {
+	repl := DB.Replication
+	infoField(b, "role", DB.Role)
+	if !DB.IsMaster() {
+		linkStatus, lastIO := "down", int64(-1)
+		if repl.MasterLinkUp.Load() {
+			linkStatus = "up"
+			lastIO = time.Now().Unix() - repl.MasterLastIO.Load()
+		}
+		infoField(b, "master_host", repl.MasterHost)
+		infoField(b, "master_port", repl.MasterPort)
+		infoField(b, "master_link_status", linkStatus)
+		infoField(b, "master_last_io_seconds_ago", lastIO)
+		infoField(b, "master_sync_in_progress", 0)
+		infoField(b, "slave_repl_offset", repl.Offset.Load())
+		infoField(b, "slave_read_only", 1)
+	}
+
+	repl.ReplicaMu.RLock()
+	var totalOutputBuffer int64
+	infoField(b, "connected_slaves", len(repl.Replicas))
+	for i, r := range repl.Replicas {
+		pending, peak := r.OutputBufferSize()
+		totalOutputBuffer += pending
+		offset, sinceAck := r.AckState()
+		host, port, _ := net.SplitHostPort(r.Conn.RemoteAddr().String())
+		infoField(b, fmt.Sprintf("slave%d", i), fmt.Sprintf("ip=%s,port=%s,state=online,offset=%d,lag=%d,omem=%d,omem_peak=%d",
+			host, port, offset, int64(sinceAck.Seconds()), pending, peak))
+	}
+	repl.ReplicaMu.RUnlock()
+
+	infoField(b, "master_replid", repl.ID)
+	infoField(b, "master_repl_offset", repl.Offset.Load())
+	infoField(b, "repl_output_buffer_total", totalOutputBuffer)
+	infoField(b, "repl_output_buffer_disconnects", atomic.LoadInt64(&repl.OutputBufferDisconnects))
+}
+
+func infoCPU(b *strings.Builder, DB *db.DB) {
+	sys, user, childSys, childUser := stats.CPU()
+	infoField(b, "used_cpu_sys", fmt.Sprintf("%.6f", sys.Seconds()))
+	infoField(b, "used_cpu_user", fmt.Sprintf("%.6f", user.Seconds()))
+	infoField(b, "used_cpu_sys_children", fmt.Sprintf("%.6f", childSys.Seconds()))
+	infoField(b, "used_cpu_user_children", fmt.Sprintf("%.6f", childUser.Seconds()))
+}
+
+func infoCommandStats(b *strings.Builder, DB *db.DB) {
+	for _, name := range stats.CommandNames() {
+		c := stats.Cmd(name)
+		calls, usec := c.Calls.Load(), c.Usec.Load()
+		var perCall float64
+		if calls > 0 {
+			perCall = float64(usec) / float64(calls)
+		}
+		infoField(b, "cmdstat_"+name, fmt.Sprintf("calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d",
+			calls, usec, perCall, c.RejectedCalls.Load(), c.FailedCalls.Load()))
+	}
+}
+
+func infoErrorStats(b *strings.Builder, DB *db.DB) {
+	counts := stats.Errors()
+	codes := make([]string, 0, len(counts))
+	for code := range counts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		infoField(b, "errorstat_"+code, fmt.Sprintf("count=%d", counts[code]))
+	}
+}
+
+func infoKeyspace(b *strings.Builder, DB *db.DB) {
+	for _, d := range DB.Databases() {
+		keys, expires, avgTTL := d.KeyspaceStats()
+		if keys > 0 {
+			infoField(b, fmt.Sprintf("db%d", d.ID), fmt.Sprintf("keys=%d,expires=%d,avg_ttl=%d", keys, expires, avgTTL))
+		}
+	}
+}
+
+// bytesToHuman formats n the way Redis' *_human fields do, e.g. "1.50M".
+func bytesToHuman(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n)/unit, "K"
+	for _, s := range []string{"M", "G", "T", "P"} {
+		if value < unit {
+			break
+		}
+		value, suffix = value/unit, s
+	}
+	return fmt.Sprintf("%.2f%s", value, suffix)
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+)
+
+// handleUnlink is DEL: values are small enough that freeing them in the
+// background would gain nothing.
+func handleUnlink(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("UNLINK", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("UNLINK")
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+
+	DB, unlock := DB.LockKeys(args[1:]...)
+	defer unlock()
+	deleted := DB.Del(args[1:]...)
+	if DB.Role == "master" {
+		if deleted > 0 {
+			DB.Propagate(args)
+		}
+		return resp.Integer(deleted), nil, nil
+	}
+	return nil, nil, nil
+}
+
+func handleExists(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("EXISTS", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("EXISTS")
+	}
+	return resp.Integer(DB.Exists(args[1:]...)), nil, nil
+}
+
+// handleTouch reports how many of the keys exist. Touching a key only
+// matters for eviction, which tracks access through the same lookups.
+func handleTouch(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("TOUCH", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("TOUCH")
+	}
+	return resp.Integer(DB.Touch(args[1:]...)), nil, nil
+}
+
+func handleRename(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("RENAME", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 3 {
+		return nil, nil, resp.WrongArgs("RENAME")
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+
+	DB, unlock := DB.LockKeys(args[1], args[2])
+	defer unlock()
+	if _, err := DB.Rename(args[1], args[2], false); err != nil {
+		return nil, nil, err
+	}
+	if DB.Role == "master" {
+		DB.Propagate(args)
+		return resp.OK, nil, nil
+	}
+	return nil, nil, nil
+}
+
+func handleRenameNX(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("RENAMENX", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 3 {
+		return nil, nil, resp.WrongArgs("RENAMENX")
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+
+	DB, unlock := DB.LockKeys(args[1], args[2])
+	defer unlock()
+	renamed, err := DB.Rename(args[1], args[2], true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if DB.Role == "master" {
+		if !renamed {
+			return resp.Integer(0), nil, nil
+		}
+		DB.Propagate(args)
+		return resp.Integer(1), nil, nil
+	}
+	return nil, nil, nil
+}
+
+// handleCopy implements COPY source destination [DB destination-db] [REPLACE].
+// The replicas get the command as is, after a SELECT of the source database.
+func handleCopy(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("COPY", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 3 {
+		return nil, nil, resp.WrongArgs("COPY")
+	}
+	if DB.ReadOnly() {
+		return nil, nil, resp.ErrReadOnly
+	}
+
+	src, dst := args[1], args[2]
+	to := DB
+	replace := false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(args[i]) {
+		case "REPLACE":
+			replace = true
+		case "DB":
+			if i+1 >= len(args) {
+				return nil, nil, resp.ErrSyntax
+			}
+			i++
+			var err error
+			if to, err = parseDBIndex(args[i], DB); err != nil {
+				return nil, nil, err
+			}
+		default:
+			return nil, nil, resp.ErrSyntax
+		}
+	}
+	if src == dst && to.ID == DB.ID {
+		return nil, nil, resp.NewError("source and destination objects are the same")
+	}
+
+	// The destination is looked up again through the locked view.
+	DB, unlock := DB.Lock([]db.KeyRef{{DB: DB.ID, Key: src}, {DB: to.ID, Key: dst}}, false)
+	defer unlock()
+	to, _ = DB.Select(to.ID)
+	if !DB.Copy(src, to, dst, replace) {
+		if DB.Role == "master" {
+			return resp.Integer(0), nil, nil
+		}
+		return nil, nil, nil
+	}
+	if DB.Role == "master" {
+		DB.Propagate(args)
+		return resp.Integer(1), nil, nil
+	}
+	return nil, nil, nil
+}
+
+func handleRandomKey(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("RANDOMKEY", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 1 {
+		return nil, nil, resp.WrongArgs("RANDOMKEY")
+	}
+
+	key, ok := DB.RandomKey()
+	if !ok {
+		return resp.Null{}, nil, nil
+	}
+	return resp.BulkString(key), nil, nil
+}
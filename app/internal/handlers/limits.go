@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+var (
+	maxClients       atomic.Int64
+	idleTimeout      atomic.Int64 // nanoseconds, 0 disables
+	connectedClients atomic.Int64
+	blockedClients   atomic.Int64
+	pubsubClients    atomic.Int64
+)
+
+func init() {
+	maxClients.Store(10000)
+}
+
+// SetMaxClients sets maxclients. Connections over the limit are sent an
+// error and closed.
+func SetMaxClients(n int64) {
+	maxClients.Store(n)
+}
+
+// SetIdleTimeout sets timeout: clients that send nothing for d are closed.
+// Replicas, subscribers, monitors and clients blocked in a command are
+// exempt. Zero disables it.
+func SetIdleTimeout(d time.Duration) {
+	idleTimeout.Store(int64(d))
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+)
+
+// handleMemory implements MEMORY USAGE and MEMORY STATS. Sizes are the
+// estimates maxmemory is enforced against, which are kept up to date as
+// values change, so USAGE accepts SAMPLES without needing it.
+func handleMemory(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("MEMORY", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("MEMORY")
+	}
+
+	switch strings.ToUpper(args[1]) {
+	case "USAGE":
+		if len(args) != 3 && len(args) != 5 {
+			return nil, nil, resp.WrongArgs("MEMORY|USAGE")
+		}
+		if len(args) == 5 {
+			if !strings.EqualFold(args[3], "SAMPLES") {
+				return nil, nil, resp.ErrSyntax
+			}
+			if n, err := strconv.ParseInt(args[4], 10, 64); err != nil || n < 0 {
+				return nil, nil, resp.ErrNotInteger
+			}
+		}
+		info, ok := DB.Inspect(args[2])
+		if !ok {
+			return resp.Null{}, nil, nil
+		}
+		return resp.Integer(info.Memory), nil, nil
+
+	case "STATS":
+		if len(args) != 2 {
+			return nil, nil, resp.WrongArgs("MEMORY|STATS")
+		}
+		return memoryStats(DB), nil, nil
+
+	case "HELP":
+		return resp.BulkStrings([]string{
+			"MEMORY <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"STATS",
+			"    Return information about the memory usage of the server.",
+			"USAGE <key> [SAMPLES <count>]",
+			"    Return memory in bytes used by <key> and its value.",
+			"HELP",
+			"    Print this help.",
+		}), nil, nil
+	}
+	return nil, nil, resp.NewError("unknown subcommand '%s'. Try MEMORY HELP.", args[1])
+}
+
+// memoryStats builds the MEMORY STATS reply. The allocator figures come from
+// the Go runtime and dataset.bytes from the estimates of the keys, so
+// overhead.total is whatever the heap holds besides the keys.
+func memoryStats(DB *db.DB) resp.Map {
+	used, sys, peak := stats.Memory()
+	dataset := DB.UsedMemory()
+	var keys int64
+	var dbs resp.Map
+	for _, d := range DB.Databases() {
+		n := d.Size()
+		if n == 0 {
+			continue
+		}
+		keys += int64(n)
+		main, expires := d.HashtableOverhead()
+		dbs = append(dbs, resp.KeyValue{Key: resp.BulkString(fmt.Sprintf("db.%d", d.ID)), Value: resp.Map{
+			{Key: resp.BulkString("overhead.hashtable.main"), Value: resp.Integer(main)},
+			{Key: resp.BulkString("overhead.hashtable.expires"), Value: resp.Integer(expires)},
+		}})
+	}
+
+	reply := resp.Map{
+		{Key: resp.BulkString("peak.allocated"), Value: resp.Integer(peak)},
+		{Key: resp.BulkString("total.allocated"), Value: resp.Integer(used)},
+		{Key: resp.BulkString("overhead.total"), Value: resp.Integer(max(int64(used)-dataset, 0))},
+	}
+	reply = append(reply, dbs...)
+	bytesPerKey := int64(0)
+	if keys > 0 {
+		bytesPerKey = dataset / keys
+	}
+	return append(reply,
+		resp.KeyValue{Key: resp.BulkString("keys.count"), Value: resp.Integer(keys)},
+		resp.KeyValue{Key: resp.BulkString("keys.bytes-per-key"), Value: resp.Integer(bytesPerKey)},
+		resp.KeyValue{Key: resp.BulkString("dataset.bytes"), Value: resp.Integer(dataset)},
+		resp.KeyValue{Key: resp.BulkString("dataset.percentage"), Value: resp.Double(percentage(dataset, int64(used)))},
+		resp.KeyValue{Key: resp.BulkString("peak.percentage"), Value: resp.Double(percentage(int64(used), int64(peak)))},
+		resp.KeyValue{Key: resp.BulkString("fragmentation"), Value: resp.Double(float64(sys) / float64(max(used, 1)))},
+	)
+}
+
+func percentage(part, total int64) float64 {
+	return float64(part) * 100 / float64(max(total, 1))
+}
+
+// handleObject implements OBJECT ENCODING, IDLETIME, FREQ and REFCOUNT.
+// Looking at a key this way does not count as an access to it.
+func handleObject(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("OBJECT", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("OBJECT")
+	}
+
+	subcommand := strings.ToUpper(args[1])
+	switch subcommand {
+	case "HELP":
+		return resp.BulkStrings([]string{
+			"OBJECT <subcommand> [<arg> [value] [opt] ...]. Subcommands are:",
+			"ENCODING <key>",
+			"    Return the kind of internal representation used in order to store the value",
+			"    associated with a <key>.",
+			"FREQ <key>",
+			"    Return the access frequency index of the <key>. The returned integer is",
+			"    proportional to the logarithm of the recent access frequency of the key.",
+			"IDLETIME <key>",
+			"    Return the idle time of the <key>, that is the approximated number of",
+			"    seconds elapsed since the last access to the key.",
+			"REFCOUNT <key>",
+			"    Return the number of references of the value associated with the specified",
+			"    <key>.",
+			"HELP",
+			"    Print this help.",
+		}), nil, nil
+	case "ENCODING", "IDLETIME", "FREQ", "REFCOUNT":
+	default:
+		return nil, nil, resp.NewError("unknown subcommand '%s'. Try OBJECT HELP.", args[1])
+	}
+	if len(args) != 3 {
+		return nil, nil, resp.WrongArgs("OBJECT|" + subcommand)
+	}
+
+	info, ok := DB.Inspect(args[2])
+	if !ok {
+		return resp.Null{}, nil, nil
+	}
+	switch subcommand {
+	case "ENCODING":
+		return resp.BulkString(info.Encoding), nil, nil
+	case "IDLETIME":
+		if DB.LFUPolicy() {
+			return nil, nil, resp.NewError("An LFU maxmemory policy is selected, idle time not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		return resp.Integer(int64(info.Idle.Seconds())), nil, nil
+	case "FREQ":
+		if !DB.LFUPolicy() {
+			return nil, nil, resp.NewError("An LFU maxmemory policy is not selected, access frequency not tracked. Please note that when switching between policies at runtime LRU and LFU data will take some time to adjust.")
+		}
+		return resp.Integer(info.Freq), nil, nil
+	}
+	return resp.Integer(info.RefCount), nil, nil
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+)
+
+// MetricsHandler serves the INFO counters in the Prometheus text exposition
+// format on /metrics.
+func MetricsHandler(DB *db.DB) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		m := &metricsWriter{w: bufio.NewWriter(w)}
+		writeMetrics(m, DB)
+		m.w.Flush()
+	})
+	return mux
+}
+
+// metricsWriter writes metric families. A family's header must be written
+// before its samples, and each family only once.
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricsWriter) family(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value. labels alternate names and values.
+func (m *metricsWriter) sample(name string, value any, labels ...string) {
+	m.w.WriteString(name)
+	if len(labels) > 0 {
+		m.w.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				m.w.WriteByte(',')
+			}
+			m.w.WriteString(labels[i])
+			m.w.WriteString(`="`)
+			m.w.WriteString(labelEscaper.Replace(labels[i+1]))
+			m.w.WriteByte('"')
+		}
+		m.w.WriteByte('}')
+	}
+	fmt.Fprintf(m.w, " %v\n", value)
+}
+
+// metric writes a family with a single unlabelled sample.
+func (m *metricsWriter) metric(name, kind, help string, value any) {
+	m.family(name, kind, help)
+	m.sample(name, value)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeMetrics(m *metricsWriter, DB *db.DB) {
+	m.family("redis_instance_info", "gauge", "Information about the server, always 1.")
+	m.sample("redis_instance_info", 1, "redis_version", serverVersion, "role", DB.Role, "run_id", runID)
+	m.metric("redis_uptime_in_seconds", "gauge", "Seconds since the server started.", int64(time.Since(stats.StartTime).Seconds()))
+
+	// Clients
+	m.metric("redis_connected_clients", "gauge", "Number of client connections.", connectedClients.Load())
+	m.metric("redis_max_clients", "gauge", "The maxclients setting.", maxClients.Load())
+	m.metric("redis_blocked_clients", "gauge", "Clients blocked in BLPOP, XREAD or WAIT.", blockedClients.Load())
+	m.metric("redis_pubsub_clients", "gauge", "Clients in subscribe mode.", pubsubClients.Load())
+
+	// Memory and CPU
+	used, sys, peak := stats.Memory()
+	m.metric("redis_memory_used_bytes", "gauge", "Estimated memory allocated by the server.", used)
+	m.metric("redis_memory_used_rss_bytes", "gauge", "Memory obtained from the operating system.", sys)
+	m.metric("redis_memory_used_peak_bytes", "gauge", "Highest value of redis_memory_used_bytes.", peak)
+	m.metric("redis_memory_used_dataset_bytes", "gauge", "Estimated memory taken by the keys, as limited by maxmemory.", DB.UsedMemory())
+	m.metric("redis_memory_max_bytes", "gauge", "The maxmemory setting.", DB.MaxMemory())
+	cpuSys, cpuUser, _, _ := stats.CPU()
+	m.metric("redis_cpu_sys_seconds_total", "counter", "System CPU time consumed.", cpuSys.Seconds())
+	m.metric("redis_cpu_user_seconds_total", "counter", "User CPU time consumed.", cpuUser.Seconds())
+
+	// Stats
+	for _, c := range []struct {
+		name, help string
+		value      *atomic.Int64
+	}{
+		{"redis_connections_received_total", "Connections accepted.", &stats.ConnectionsReceived},
+		{"redis_rejected_connections_total", "Connections rejected because of maxclients.", &stats.RejectedConnections},
+		{"redis_commands_processed_total", "Commands executed.", &stats.CommandsProcessed},
+		{"redis_net_input_bytes_total", "Bytes read from clients and the master.", &stats.NetInputBytes},
+		{"redis_net_output_bytes_total", "Bytes written to clients and replicas.", &stats.NetOutputBytes},
+		{"redis_expired_keys_total", "Keys deleted because their TTL passed.", &stats.ExpiredKeys},
+		{"redis_evicted_keys_total", "Keys evicted because of maxmemory.", &stats.EvictedKeys},
+		{"redis_keyspace_hits_total", "Successful key lookups.", &stats.KeyspaceHits},
+		{"redis_keyspace_misses_total", "Failed key lookups.", &stats.KeyspaceMisses},
+	} {
+		m.metric(c.name, "counter", c.help, c.value.Load())
+	}
+
+	errorCounts := stats.Errors()
+	codes := make([]string, 0, len(errorCounts))
+	for code := range errorCounts {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	m.family("redis_errors_total", "counter", "Error replies by error code.")
+	for _, code := range codes {
+		m.sample("redis_errors_total", errorCounts[code], "err", code)
+	}
+
+	// Commands
+	names := stats.CommandNames()
+	commands := make([]*stats.Command, len(names))
+	for i, name := range names {
+		commands[i] = stats.Cmd(name)
+	}
+	m.family("redis_commands_total", "counter", "Calls per command.")
+	for i, c := range commands {
+		m.sample("redis_commands_total", c.Calls.Load(), "cmd", names[i])
+	}
+	m.family("redis_commands_failed_calls_total", "counter", "Calls per command that replied with an error.")
+	for i, c := range commands {
+		m.sample("redis_commands_failed_calls_total", c.FailedCalls.Load(), "cmd", names[i])
+	}
+	m.family("redis_commands_rejected_calls_total", "counter", "Calls per command refused before running.")
+	for i, c := range commands {
+		m.sample("redis_commands_rejected_calls_total", c.RejectedCalls.Load(), "cmd", names[i])
+	}
+	m.family("redis_command_duration_seconds", "histogram", "Command execution time.")
+	for i, c := range commands {
+		for j, count := range c.Histogram() {
+			m.sample("redis_command_duration_seconds_bucket", count, "cmd", names[i], "le", formatSeconds(stats.LatencyBuckets[j]))
+		}
+		calls := c.Calls.Load()
+		m.sample("redis_command_duration_seconds_bucket", calls, "cmd", names[i], "le", "+Inf")
+		m.sample("redis_command_duration_seconds_sum", float64(c.Usec.Load())/1e6, "cmd", names[i])
+		m.sample("redis_command_duration_seconds_count", calls, "cmd", names[i])
+	}
+
+	// Keyspace, for the databases holding keys as in INFO keyspace
+	var nonEmpty []*db.DB
+	for _, d := range DB.Databases() {
+		if d.Size() > 0 {
+			nonEmpty = append(nonEmpty, d)
+		}
+	}
+	m.family("redis_keys", "gauge", "Keys by database and value type.")
+	for _, d := range nonEmpty {
+		keysByType := d.KeysByType()
+		types := make([]string, 0, len(keysByType))
+		for t := range keysByType {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		for _, t := range types {
+			m.sample("redis_keys", keysByType[t], "db", fmt.Sprintf("db%d", d.ID), "type", t)
+		}
+	}
+	m.family("redis_keys_expiring", "gauge", "Keys with a TTL by database.")
+	for _, d := range nonEmpty {
+		_, expires, _ := d.KeyspaceStats()
+		m.sample("redis_keys_expiring", expires, "db", fmt.Sprintf("db%d", d.ID))
+	}
+
+	// Replication
+	repl := DB.Replication
+	m.metric("redis_master_repl_offset", "gauge", "Replication offset.", repl.Offset.Load())
+	if !DB.IsMaster() {
+		linkUp := 0
+		if repl.MasterLinkUp.Load() {
+			linkUp = 1
+		}
+		m.metric("redis_master_link_up", "gauge", "Whether the link to the master is up.", linkUp)
+	}
+	repl.ReplicaMu.RLock()
+	replicas := append([]*db.ReplicaConn(nil), repl.Replicas...)
+	repl.ReplicaMu.RUnlock()
+	m.metric("redis_connected_slaves", "gauge", "Number of connected replicas.", len(replicas))
+	type replicaState struct {
+		ip, port string
+		offset   int64
+		lag      time.Duration
+		pending  int64
+	}
+	states := make([]replicaState, len(replicas))
+	for i, r := range replicas {
+		s := &states[i]
+		s.ip, s.port, _ = net.SplitHostPort(r.Conn.RemoteAddr().String())
+		s.offset, s.lag = r.AckState()
+		s.pending, _ = r.OutputBufferSize()
+	}
+	m.family("redis_connected_slave_offset_bytes", "gauge", "Replication offset last acknowledged by each replica.")
+	for _, s := range states {
+		m.sample("redis_connected_slave_offset_bytes", s.offset, "slave_ip", s.ip, "slave_port", s.port)
+	}
+	m.family("redis_connected_slave_lag_seconds", "gauge", "Seconds since each replica last acknowledged.")
+	for _, s := range states {
+		m.sample("redis_connected_slave_lag_seconds", s.lag.Seconds(), "slave_ip", s.ip, "slave_port", s.port)
+	}
+	m.family("redis_connected_slave_output_buffer_bytes", "gauge", "Bytes queued for each replica.")
+	for _, s := range states {
+		m.sample("redis_connected_slave_output_buffer_bytes", s.pending, "slave_ip", s.ip, "slave_port", s.port)
+	}
+
+	// Pub/Sub
+	m.metric("redis_pubsub_channels", "gauge", "Channels with at least one subscriber.", DB.PubSub.NumChannels())
+	m.metric("redis_pubsub_patterns", "gauge", "Patterns with at least one subscriber.", DB.PubSub.NumPatterns())
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'g', -1, 64)
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+)
+
+// monitors are the clients that issued MONITOR. Every command received by
+// the server is echoed to them.
+var monitors = struct {
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+	count   atomic.Int32
+}{clients: map[*client]struct{}{}}
+
+func addMonitor(c *client) {
+	monitors.mu.Lock()
+	defer monitors.mu.Unlock()
+	if _, ok := monitors.clients[c]; !ok {
+		monitors.clients[c] = struct{}{}
+		monitors.count.Add(1)
+	}
+}
+
+func removeMonitor(c *client) {
+	monitors.mu.Lock()
+	defer monitors.mu.Unlock()
+	if _, ok := monitors.clients[c]; ok {
+		delete(monitors.clients, c)
+		monitors.count.Add(-1)
+	}
+}
+
+// monitoring reports whether any client is in MONITOR mode, for callers to
+// skip preparing what feedMonitors would discard.
+func monitoring() bool {
+	return monitors.count.Load() > 0
+}
+
+// feedMonitors sends a command to every monitor in the MONITOR format:
+//
+//	+1339518083.107412 [0 127.0.0.1:60866] "set" "key" "value"
+func feedMonitors(source string, args []string) {
+	if monitors.count.Load() == 0 {
+		return
+	}
+
+	now := time.Now()
+	line := strconv.AppendInt(nil, now.Unix(), 10)
+	line = append(line, '.')
+	line = appendPadded(line, int64(now.Nanosecond()/1000), 6)
+	line = append(line, " [0 "...)
+	line = append(line, source...)
+	line = append(line, ']')
+	// Credentials given to HELLO must not leak to monitors.
+	redact := len(args) > 0 && commandName([]byte(args[0])) == "HELLO"
+	for i, arg := range args {
+		line = append(line, ' ')
+		if i > 0 && redact {
+			arg = "(redacted)"
+		}
+		line = appendRepr(line, arg)
+	}
+	msg := resp.SimpleString(line)
+
+	monitors.mu.RLock()
+	defer monitors.mu.RUnlock()
+	for m := range monitors.clients {
+		m.push(msg)
+	}
+}
+
+func appendPadded(buf []byte, n int64, width int) []byte {
+	digits := strconv.FormatInt(n, 10)
+	for i := len(digits); i < width; i++ {
+		buf = append(buf, '0')
+	}
+	return append(buf, digits...)
+}
+
+// appendRepr quotes s the way Redis' sdscatrepr does, so every argument
+// fits on one line.
+func appendRepr(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	buf = append(buf, '"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '"':
+			buf = append(buf, '\\', c)
+		case '\n':
+			buf = append(buf, '\\', 'n')
+		case '\r':
+			buf = append(buf, '\\', 'r')
+		case '\t':
+			buf = append(buf, '\\', 't')
+		case '\a':
+			buf = append(buf, '\\', 'a')
+		case '\b':
+			buf = append(buf, '\\', 'b')
+		default:
+			if c < 0x20 || c >= 0x7f {
+				buf = append(buf, '\\', 'x', hex[c>>4], hex[c&0xf])
+			} else {
+				buf = append(buf, c)
+			}
+		}
+	}
+	return append(buf, '"')
+}
@@ -2,9 +2,9 @@ package handlers
 
 import (
 	"fmt"
-	"net"
 
 	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
 )
 
 var emptyRDB = []byte{
@@ -19,22 +19,17 @@ var emptyRDB = []byte{
 	0xf0, 0x6e, 0x3b, 0xfe, 0xc0, 0xff, 0x5a, 0xa2,
 }
 
-func handlePsync(conn net.Conn, DB *db.DB) error {
-	fullResyncCmd := fmt.Sprintf("+FULLRESYNC %s %d\r\n", DB.Replication.ID, DB.Replication.Offset)
-	_, err := conn.Write([]byte(fullResyncCmd))
-	if err != nil {
-		return fmt.Errorf("failed to send FULLRESYNC response: %w", err)
-	}
+// handlePsync sends the full resynchronization through the client's output
+// queue, which then becomes the replica's replication stream.
+func handlePsync(c *client, DB *db.DB) error {
+	fullResync := resp.SimpleString(fmt.Sprintf("FULLRESYNC %s %d", DB.Replication.ID, DB.Replication.Offset.Load()))
+	c.out.AppendValue(fullResync, resp.RESP2)
 
-	rdbFileHeader := fmt.Sprintf("$%d\r\n", len(emptyRDB))
-	_, err = conn.Write([]byte(rdbFileHeader))
-	if err != nil {
-		return fmt.Errorf("failed to send RDB file header: %w", err)
-	}
-	_, err = conn.Write(emptyRDB)
-	if err != nil {
+	// The RDB payload is a bulk string without the trailing CRLF.
+	c.out.Append([]byte(fmt.Sprintf("$%d\r\n", len(emptyRDB))))
+	if _, err := c.out.Send(emptyRDB); err != nil {
 		return fmt.Errorf("failed to send empty RDB file: %w", err)
 	}
-	DB.AddReplica(conn)
+	DB.AddReplica(c.conn, c.out)
 	return nil
 }
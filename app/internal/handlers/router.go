@@ -2,59 +2,170 @@ package handlers
 
 import (
 	"bufio"
-	"fmt"
+	"context"
+	"errors"
+	"io"
 	"net"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/exchange"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/output"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
-	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
 )
 
-// CmdHandler now takes a transaction object and returns the RESP string, the updated transaction and an error.
-type CmdHandler func(args []string, DB *db.DB, activeTx *transaction.Transaction) (string, *transaction.Transaction, error)
+// CmdHandler now takes a transaction object and returns the reply, the updated transaction and an error.
+// A nil reply means nothing is sent back, as for commands applied from a master.
+// Errors are sent using their resp.Error code, defaulting to ERR.
+type CmdHandler func(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error)
 
 // Map command strings to handler functions, updated for the new signature.
 var commandHandlers = map[string]CmdHandler{
-	"PING":     handlePing,
-	"ECHO":     handleEcho,
-	"SET":      handleSet,
-	"GET":      handleGet,
-	"TYPE":     handleType,
-	"XADD":     handleXAdd,
-	"XRANGE":   handleXRange,
-	"INCR":     handleINCR,
-	"MULTI":    handleMulti,
-	"INFO":     handleInfo,
-	"REPLCONF": handleReplconf,
-	"WAIT":     handleWait,
-	"CONFIG":   handleConfig,
-	"KEYS":     handleKeys,
-	"PUBLISH":  handlePublish,
-	"RPUSH":    handleRPush,
-	"LPUSH":    handleLPush,
-	"LRANGE":   handleLRange,
-	"LLEN":     handleLLen,
-	"LPOP":     handleLPop,
-	"BLPOP":    handleBlpop,
+	"PING":        handlePing,
+	"ECHO":        handleEcho,
+	"SET":         handleSet,
+	"GET":         handleGet,
+	"MGET":        handleMGet,
+	"DEL":         handleDel,
+	"TYPE":        handleType,
+	"XADD":        handleXAdd,
+	"XRANGE":      handleXRange,
+	"INCR":        handleINCR,
+	"MULTI":       handleMulti,
+	"INFO":        handleInfo,
+	"REPLCONF":    handleReplconf,
+	"WAIT":        handleWait,
+	"CONFIG":      handleConfig,
+	"KEYS":        handleKeys,
+	"PUBLISH":     handlePublish,
+	"RPUSH":       handleRPush,
+	"LPUSH":       handleLPush,
+	"LRANGE":      handleLRange,
+	"LLEN":        handleLLen,
+	"LPOP":        handleLPop,
+	"BLPOP":       handleBlpop,
+	"UNLINK":      handleUnlink,
+	"EXISTS":      handleExists,
+	"TOUCH":       handleTouch,
+	"RENAME":      handleRename,
+	"RENAMENX":    handleRenameNX,
+	"COPY":        handleCopy,
+	"RANDOMKEY":   handleRandomKey,
+	"EXPIRE":      handleExpire,
+	"PEXPIRE":     handlePExpire,
+	"EXPIREAT":    handleExpireAt,
+	"PEXPIREAT":   handlePExpireAt,
+	"TTL":         handleTTL,
+	"PTTL":        handlePTTL,
+	"EXPIRETIME":  handleExpireTime,
+	"PEXPIRETIME": handlePExpireTime,
+	"PERSIST":     handlePersist,
+	"SAVE":        handleSave,
+	"BGSAVE":      handleBGSave,
+	"LASTSAVE":    handleLastSave,
+	"SCAN":        handleScan,
+	"MOVE":        handleMove,
+	"SWAPDB":      handleSwapDB,
+	"FLUSHDB":     handleFlushDB,
+	"FLUSHALL":    handleFlushAll,
+	"DBSIZE":      handleDBSize,
+	"MEMORY":      handleMemory,
+	"OBJECT":      handleObject,
 }
 
-func handleXReadWrapper(conn net.Conn, args []string, DB *db.DB, activeTx *transaction.Transaction) (*transaction.Transaction, error) {
+// denyOOMCommands may use more memory, so they are refused while the keys
+// cannot be brought under maxmemory.
+var denyOOMCommands = map[string]bool{
+	"SET":   true,
+	"INCR":  true,
+	"XADD":  true,
+	"RPUSH": true,
+	"LPUSH": true,
+	"COPY":  true,
+}
+
+// checkMaxMemory evicts keys if needed before a command runs, and refuses
+// the command if it may use more memory and there is none left.
+func checkMaxMemory(command string, DB *db.DB) error {
+	if err := DB.EnforceMaxMemory(); err != nil && denyOOMCommands[command] {
+		return err
+	}
+	return nil
+}
+
+// blockingCommands may wait for other clients before replying.
+var blockingCommands = map[string]bool{
+	"BLPOP": true,
+	"XREAD": true,
+	"WAIT":  true,
+}
+
+// knownCommands interns upper-cased command names so that looking up the
+// name of an incoming request does not allocate.
+var knownCommands = func() map[string]string {
+	names := map[string]string{}
+	for name := range commandHandlers {
+		names[name] = name
+	}
+	for _, name := range []string{"EXEC", "DISCARD", "SELECT", "XREAD", "PSYNC", "HELLO", "MONITOR", "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE", "QUIT", "RESET"} {
+		names[name] = name
+	}
+	return names
+}()
+
+// commandName upper-cases a request's command name.
+func commandName(name []byte) string {
+	var scratch [32]byte
+	if len(name) > len(scratch) {
+		return strings.ToUpper(string(name))
+	}
+	upper := scratch[:len(name)]
+	for i, c := range name {
+		if c >= 'a' && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		upper[i] = c
+	}
+	if known, ok := knownCommands[string(upper)]; ok {
+		return known
+	}
+	return string(upper)
+}
+
+func handleXReadWrapper(c *client, args []string, DB *db.DB, activeTx *transaction.Transaction) (*transaction.Transaction, error) {
 	response, tx, err := handleXRead(args, DB, activeTx)
 	if err != nil {
-		writeError(conn, err)
+		c.writeError(err)
 		return tx, nil
 	}
-	conn.Write([]byte(response))
+	c.write(response)
 	return tx, nil
 }
 
 func HandleMasterConnection(conn net.Conn, DB *db.DB, reader *bufio.Reader) {
 	var activeTx *transaction.Transaction
+	log := logger.With("master", connAddr(conn))
+
+	DB.Replication.MasterLinkUp.Store(true)
+	defer DB.Replication.MasterLinkUp.Store(false)
+	DB = DB.MasterStream()
 
+	respReader := resp.NewReader(reader)
 	for {
-		args := utils.ParseArgs(reader)
-		if args == nil {
+		args, err := respReader.ReadCommand()
+		if err != nil {
+			if err == io.EOF {
+				log.Warn("Connection with master lost")
+			} else {
+				log.Warn("Error reading from master", "err", err)
+			}
 			return
 		}
 
@@ -62,150 +173,338 @@ func HandleMasterConnection(conn net.Conn, DB *db.DB, reader *bufio.Reader) {
 			continue
 		}
 
+		DB.Replication.MasterLastIO.Store(time.Now().Unix())
+		stats.NetInputBytes.Add(int64(respReader.LastCommandSize()))
+		feedMonitors(connAddr(conn), args)
 		command := strings.ToUpper(args[0])
 
-		if handler, ok := commandHandlers[command]; ok {
-			respCmdLength := len(utils.FormatRESPArray(args))
+		if command == "SELECT" {
+			// The master selects the database of the commands that follow.
+			if selected, err := selectDB(args, DB); err != nil {
+				log.Warn("Error handling command from master", "command", command, "err", err)
+			} else {
+				DB = selected
+			}
+			DB.UpdateOffset(respReader.LastCommandSize())
+		} else if handler, ok := commandHandlers[command]; ok {
+			respCmdLength := respReader.LastCommandSize()
 
+			start := time.Now()
 			response, _, err := handler(args, DB, activeTx)
+			stats.RecordCall(command, time.Since(start), err != nil)
 			if err != nil {
 				writeError(conn, err)
-				fmt.Printf("Error handling command from master: %v\n", err)
+				log.Warn("Error handling command from master", "command", command, "err", err)
 				continue
 			}
-			if response != "" {
-				conn.Write([]byte(response))
+			if response != nil {
+				conn.Write(resp.Encode(response, resp.RESP2))
 			}
 			DB.UpdateOffset(respCmdLength)
 		} else {
-			errorMsg := fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
-			conn.Write([]byte(errorMsg))
-			fmt.Printf("Unknown command from master: '%s'\n", args[0])
+			writeError(conn, resp.NewError("unknown command '%s'", args[0]))
+			log.Warn("Unknown command from master", "command", args[0])
 		}
 	}
 }
 
 func HandleConnection(conn net.Conn, DB *db.DB) {
-	defer conn.Close()
-	defer DB.RemoveReplica(conn)
-	reader := bufio.NewReader(conn)
+	stats.ConnectionsReceived.Add(1)
+	if connectedClients.Add(1) > maxClients.Load() {
+		connectedClients.Add(-1)
+		stats.RejectedConnections.Add(1)
+		conn.Write(resp.Encode(resp.NewError("max number of clients reached"), resp.RESP2))
+		conn.Close()
+		return
+	}
+	defer connectedClients.Add(-1)
+
+	// The reader buffers on its own; it must see every byte read from conn
+	// for Buffered to tell when the pipeline is drained.
+	reader := resp.NewReader(conn)
+	c := newClient(conn)
 	var activeTx *transaction.Transaction
-	var inSubscribeMode bool
+	var inSubscribeMode, isReplica, isMonitor, hasDeadline bool
 	clientSubscriptions := make(map[string]chan string)
+	clientPatterns := make(map[string]chan exchange.Message)
+
+	defer func() {
+		for channel, subChannel := range clientSubscriptions {
+			DB.PubSub.Unsubscribe(channel, subChannel)
+		}
+		for pattern, subChannel := range clientPatterns {
+			DB.PubSub.PUnsubscribe(pattern, subChannel)
+		}
+		if inSubscribeMode {
+			pubsubClients.Add(-1)
+		}
+		removeMonitor(c)
+		DB.RemoveReplica(conn)
+		c.close()
+	}()
 
 	for {
-		args := utils.ParseArgs(reader)
-		if args == nil {
+		// Like Redis, batch the replies of a pipeline into as few writes as
+		// possible: only flush once no more requests are already buffered.
+		if reader.Buffered() == 0 {
+			if err := c.flush(); err != nil {
+				return
+			}
+			// The idle timeout only applies while waiting for a new request;
+			// a client blocked in BLPOP or WAIT is not reading.
+			if timeout := time.Duration(idleTimeout.Load()); timeout > 0 && !isReplica && !isMonitor && !inSubscribeMode {
+				conn.SetReadDeadline(time.Now().Add(timeout))
+				hasDeadline = true
+			} else if hasDeadline {
+				conn.SetReadDeadline(time.Time{})
+				hasDeadline = false
+			}
+		}
+
+		argv, err := reader.ReadArgs()
+		if err != nil {
+			var protoErr *resp.ProtocolError
+			if errors.As(err, &protoErr) {
+				c.log.Log(context.Background(), logger.LevelVerbose, "Protocol error from client", "err", protoErr.Msg)
+				c.writeError(protoErr)
+			} else if errors.Is(err, os.ErrDeadlineExceeded) {
+				c.log.Log(context.Background(), logger.LevelVerbose, "Closing idle client")
+			}
 			return
 		}
 
-		if len(args) == 0 {
+		if len(argv) == 0 {
 			continue
 		}
 
-		command := strings.ToUpper(args[0])
+		command := commandName(argv[0])
+		stats.NetInputBytes.Add(int64(reader.LastCommandSize()))
+		if monitoring() {
+			feedMonitors(connAddr(conn), reader.Strings())
+		}
+		if blockingCommands[command] {
+			// Replies to earlier pipelined commands must not wait for
+			// a command that may block indefinitely.
+			c.flush()
+		}
 
-		if inSubscribeMode {
+		// RESP3 clients can keep issuing regular commands while subscribed,
+		// since pushes cannot be confused with replies.
+		if inSubscribeMode && c.protocol() == resp.RESP2 {
 			switch command {
 			case "SUBSCRIBE", "UNSUBSCRIBE", "PSUBSCRIBE", "PUNSUBSCRIBE", "QUIT", "RESET":
 				//
 			case "PING":
-				response := "*2\r\n$4\r\npong\r\n$0\r\n\r\n"
-				conn.Write([]byte(response))
+				c.write(resp.BulkStrings([]string{"pong", ""}))
 				continue
 			default:
-				errorMsg := fmt.Sprintf("-ERR Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context\r\n", strings.ToLower(args[0]))
-				conn.Write([]byte(errorMsg))
+				c.writeError(resp.NewError("Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", strings.ToLower(string(argv[0]))))
+				if _, known := knownCommands[command]; known {
+					stats.RecordRejected(command)
+				}
 				continue
 			}
 		}
-		if command == "EXEC" {
-			response, newTx, err := handleExec(DB, activeTx, commandHandlers)
-			activeTx = newTx
+		// Handlers take the arguments as strings, which are only made once
+		// the command is going to run.
+		args := reader.Strings()
+		if isReplica && command == "REPLCONF" && len(args) == 3 && strings.EqualFold(args[1], "ACK") {
+			if offset, err := strconv.ParseInt(args[2], 10, 64); err == nil {
+				DB.ReplicaAck(conn, offset)
+			}
+		}
+
+		if blockingCommands[command] {
+			blockedClients.Add(1)
+		}
+		start := time.Now()
+		c.failed = false
+		queued := false
+		if command == "HELLO" {
+			response, err := handleHello(args, DB, c)
 			if err != nil {
-				writeError(conn, err)
-				continue
+				c.writeError(err)
+			} else {
+				c.write(response)
 			}
-			conn.Write([]byte(response))
-			continue
-		} else if handler, ok := commandHandlers[command]; ok {
-			// Check if we are in a transaction
+		} else if command == "EXEC" {
+			var response resp.Value
+			var err error
+			response, DB, activeTx, err = handleExec(DB, activeTx, commandHandlers)
+			if err != nil {
+				c.writeError(err)
+			} else {
+				c.write(response)
+			}
+		} else if command == "SELECT" {
 			if activeTx != nil {
 				activeTx.AddCommand(command, args[1:])
-				conn.Write([]byte("+QUEUED\r\n"))
-				continue
+				c.write(resp.Queued)
+				queued = true
+			} else if selected, err := selectDB(args, DB); err != nil {
+				c.writeError(err)
+			} else {
+				DB = selected
+				c.write(resp.OK)
 			}
-
-			// Handle regular commands outside of a transaction or special commands like MULTI
-			response, newTx, err := handler(args, DB, activeTx)
-			if err != nil {
-				writeError(conn, err)
-				activeTx = nil // Reset transaction on error
-				continue
+		} else if handler, ok := commandHandlers[command]; ok {
+			if err := checkMaxMemory(command, DB); err != nil {
+				c.writeError(err)
+				if activeTx != nil {
+					activeTx.Abort()
+				}
+			} else if activeTx != nil {
+				// In a transaction, commands are only queued until EXEC.
+				activeTx.AddCommand(command, args[1:])
+				c.write(resp.Queued)
+				queued = true
+			} else {
+				// Handle regular commands outside of a transaction or special commands like MULTI
+				response, newTx, err := handler(args, DB, activeTx)
+				if err != nil {
+					c.writeError(err)
+					activeTx = nil // Reset transaction on error
+				} else {
+					activeTx = newTx
+					if response != nil {
+						c.write(response)
+					}
+				}
 			}
-			activeTx = newTx
-			conn.Write([]byte(response))
-
 		} else if command == "XREAD" {
 			// XREAD needs direct access to conn for blocking, so it's handled as a special case.
-			activeTx, _ = handleXReadWrapper(conn, args, DB, activeTx)
+			activeTx, _ = handleXReadWrapper(c, args, DB, activeTx)
 		} else if command == "DISCARD" {
 			response, newTx, err := handleDiscard(activeTx)
 			activeTx = newTx
 			if err != nil {
-				writeError(conn, err)
+				c.writeError(err)
+			} else {
+				c.write(response)
 			}
-			conn.Write([]byte(response))
 		} else if command == "PSYNC" {
-			if err := handlePsync(conn, DB); err != nil {
-				writeError(conn, err)
+			// From here on the connection belongs to the replication stream.
+			if err := handlePsync(c, DB); err != nil {
+				c.writeError(err)
+			} else {
+				isReplica = true
+			}
+		} else if command == "MONITOR" {
+			if activeTx != nil {
+				c.writeError(resp.NewError("MONITOR is not allowed in MULTI"))
+				activeTx.Abort()
+			} else {
+				addMonitor(c)
+				isMonitor = true
+				c.write(resp.OK)
 			}
-			fmt.Printf("Replica count after PSYNC: %d\n", len(DB.Replication.Replicas))
 		} else if command == "SUBSCRIBE" {
 			if len(args) < 2 {
-				writeError(conn, fmt.Errorf(" wrong number of arguments for 'SUBSCRIBE' command"))
-				continue
-			}
-			channel := args[1]
-			if _, ok := clientSubscriptions[channel]; !ok {
-				subChannel, _ := DB.PubSub.Subscribe(channel)
-				clientSubscriptions[channel] = subChannel
-				inSubscribeMode = true
-
-				go func() {
-					for msg := range subChannel {
-						resp := fmt.Sprintf("*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n", len(channel), channel, len(msg), msg)
-						conn.Write([]byte(resp))
+				c.writeError(resp.WrongArgs("SUBSCRIBE"))
+			} else {
+				channel := args[1]
+				if _, ok := clientSubscriptions[channel]; !ok {
+					subChannel, _ := DB.PubSub.Subscribe(channel)
+					clientSubscriptions[channel] = subChannel
+					if !inSubscribeMode {
+						pubsubClients.Add(1)
+						c.out.SetClass(output.PubSub)
 					}
-				}()
+					inSubscribeMode = true
+
+					go func() {
+						for msg := range subChannel {
+							c.push(resp.Push{resp.BulkString("message"), resp.BulkString(channel), resp.BulkString(msg)})
+						}
+					}()
+				}
+				subscribersCount := len(clientSubscriptions) + len(clientPatterns)
+				c.write(resp.Push{resp.BulkString("subscribe"), resp.BulkString(channel), resp.Integer(subscribersCount)})
 			}
-			subscribersCount := len(clientSubscriptions)
-			response := fmt.Sprintf("*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, subscribersCount)
-			conn.Write([]byte(response))
 		} else if command == "UNSUBSCRIBE" {
 			if len(args) < 2 {
-				writeError(conn, fmt.Errorf(" wrong number of arguments for 'UNSUBSCRIBE' command"))
-				continue
-			}
-			channel := args[1]
-			subChannel, ok := clientSubscriptions[channel]
-			if ok {
-				DB.PubSub.Unsubscribe(channel, subChannel)
-				delete(clientSubscriptions, channel)
+				c.writeError(resp.WrongArgs("UNSUBSCRIBE"))
+			} else {
+				channel := args[1]
+				subChannel, ok := clientSubscriptions[channel]
+				if ok {
+					DB.PubSub.Unsubscribe(channel, subChannel)
+					delete(clientSubscriptions, channel)
+				}
+				subscribersCount := len(clientSubscriptions) + len(clientPatterns)
+				c.write(resp.Push{resp.BulkString("unsubscribe"), resp.BulkString(channel), resp.Integer(subscribersCount)})
+
+				if subscribersCount == 0 && inSubscribeMode {
+					pubsubClients.Add(-1)
+					c.out.SetClass(output.Normal)
+					inSubscribeMode = false
+				}
 			}
-			subscribersCount := len(clientSubscriptions)
-			response := fmt.Sprintf("*3\r\n$11\r\nunsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, subscribersCount)
-			conn.Write([]byte(response))
+		} else if command == "PSUBSCRIBE" {
+			if len(args) < 2 {
+				c.writeError(resp.WrongArgs("PSUBSCRIBE"))
+			} else {
+				for _, pattern := range args[1:] {
+					if _, ok := clientPatterns[pattern]; !ok {
+						subChannel := DB.PubSub.PSubscribe(pattern)
+						clientPatterns[pattern] = subChannel
+						if !inSubscribeMode {
+							pubsubClients.Add(1)
+							c.out.SetClass(output.PubSub)
+						}
+						inSubscribeMode = true
 
-			if subscribersCount == 0 {
+						go func() {
+							for msg := range subChannel {
+								c.push(resp.Push{resp.BulkString("pmessage"), resp.BulkString(pattern), resp.BulkString(msg.Channel), resp.BulkString(msg.Payload)})
+							}
+						}()
+					}
+					subscribersCount := len(clientSubscriptions) + len(clientPatterns)
+					c.write(resp.Push{resp.BulkString("psubscribe"), resp.BulkString(pattern), resp.Integer(subscribersCount)})
+				}
+			}
+		} else if command == "PUNSUBSCRIBE" {
+			// Without arguments, every pattern is unsubscribed.
+			patterns := args[1:]
+			if len(patterns) == 0 {
+				for pattern := range clientPatterns {
+					patterns = append(patterns, pattern)
+				}
+				sort.Strings(patterns)
+			}
+			if len(patterns) == 0 {
+				c.write(resp.Push{resp.BulkString("punsubscribe"), resp.Null{}, resp.Integer(len(clientSubscriptions))})
+			}
+			for _, pattern := range patterns {
+				if subChannel, ok := clientPatterns[pattern]; ok {
+					DB.PubSub.PUnsubscribe(pattern, subChannel)
+					delete(clientPatterns, pattern)
+				}
+				subscribersCount := len(clientSubscriptions) + len(clientPatterns)
+				c.write(resp.Push{resp.BulkString("punsubscribe"), resp.BulkString(pattern), resp.Integer(subscribersCount)})
+			}
+			if len(clientSubscriptions)+len(clientPatterns) == 0 && inSubscribeMode {
+				pubsubClients.Add(-1)
+				c.out.SetClass(output.Normal)
 				inSubscribeMode = false
 			}
 		} else {
-			errorMsg := fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
-			conn.Write([]byte(errorMsg))
+			c.writeError(resp.NewError("unknown command '%s'", args[0]))
+			// Like Redis, a command rejected while queuing dooms the whole
+			// transaction: EXEC will answer EXECABORT.
 			if activeTx != nil {
-				activeTx = nil
+				activeTx.Abort()
 			}
 		}
+
+		if blockingCommands[command] {
+			blockedClients.Add(-1)
+		}
+		// Queued commands are accounted for when EXEC runs them, and
+		// unknown commands only show up in errorstats.
+		if _, known := knownCommands[command]; known && !queued {
+			stats.RecordCall(command, time.Since(start), c.failed)
+		}
 	}
 }
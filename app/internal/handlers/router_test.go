@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
+)
+
+// testClient is a connection served by HandleConnection.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func newTestClient(t *testing.T, DB *db.DB) *testClient {
+	t.Helper()
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		HandleConnection(server, DB)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		client.Close()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("the connection is still being served after closing")
+		}
+	})
+	return &testClient{t, client}
+}
+
+// do sends a command and checks that the reply is want, failing if it does
+// not come within a second.
+func (c *testClient) do(want string, args ...string) {
+	c.t.Helper()
+	c.conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := c.conn.Write([]byte(utils.FormatRESPArray(args))); err != nil {
+		c.t.Fatalf("%q: %v", args, err)
+	}
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(c.conn, got); err != nil {
+		c.t.Fatalf("%q: %v after %q", args, err, got)
+	}
+	if string(got) != want {
+		c.t.Fatalf("%q = %q, want %q", args, got, want)
+	}
+}
+
+// Commands that would wait for other clients answer at once in a
+// transaction, which holds its shard locks until EXEC is done.
+func TestExecDoesNotBlock(t *testing.T) {
+	DB := db.New("master", 16)
+	c, other := newTestClient(t, DB), newTestClient(t, DB)
+
+	c.do("+OK\r\n", "MULTI")
+	c.do("+QUEUED\r\n", "BLPOP", "q", "0")
+	c.do("+QUEUED\r\n", "WAIT", "1", "0")
+	c.do("*2\r\n$-1\r\n:0\r\n", "EXEC")
+
+	other.do(":1\r\n", "RPUSH", "q", "a")
+	c.do("+OK\r\n", "MULTI")
+	c.do("+QUEUED\r\n", "BLPOP", "q", "0")
+	c.do("*1\r\n*2\r\n$1\r\nq\r\n$1\r\na\r\n", "EXEC")
+	other.do("+OK\r\n", "SET", "k", "v")
+}
+
+// BenchmarkPipeline measures HandleConnection with pipelines of 1, 16 and
+// 256 commands, half SET and half GET, over an in-memory connection: each
+// iteration sends a pipeline and reads all of its replies.
+func BenchmarkPipeline(b *testing.B) {
+	for _, depth := range []int{1, 16, 256} {
+		b.Run(fmt.Sprintf("depth=%d", depth), func(b *testing.B) {
+			benchmarkPipeline(b, depth)
+		})
+	}
+}
+
+func benchmarkPipeline(b *testing.B, depth int) {
+	DB := db.New("master", 16)
+	DB.Set("key", "value", 0)
+
+	var pipeline, replies []byte
+	for i := range depth {
+		if i%2 == 0 {
+			pipeline = append(pipeline, utils.FormatRESPArray([]string{"SET", "key", "value"})...)
+			replies = append(replies, "+OK\r\n"...)
+		} else {
+			pipeline = append(pipeline, utils.FormatRESPArray([]string{"GET", "key"})...)
+			replies = append(replies, "$5\r\nvalue\r\n"...)
+		}
+	}
+
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		HandleConnection(server, DB)
+		close(done)
+	}()
+	defer func() {
+		client.Close()
+		<-done
+	}()
+
+	got := make([]byte, len(replies))
+	b.SetBytes(int64(len(pipeline)))
+	b.ResetTimer()
+	for range b.N {
+		if _, err := client.Write(pipeline); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := io.ReadFull(client, got); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if !bytes.Equal(got, replies) {
+		b.Fatalf("replies = %q, want %q", got, replies)
+	}
+	b.ReportMetric(float64(b.N*depth)/b.Elapsed().Seconds(), "cmds/s")
+}
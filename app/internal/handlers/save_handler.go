@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+)
+
+func handleSave(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("SAVE", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 1 {
+		return nil, nil, resp.WrongArgs("SAVE")
+	}
+	if err := DB.Save(); err != nil {
+		return nil, nil, resp.NewError("%s", err)
+	}
+	return resp.OK, nil, nil
+}
+
+// handleBGSave implements BGSAVE [SCHEDULE]. A save already running is
+// reported as an error, SCHEDULE or not.
+func handleBGSave(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("BGSAVE", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) > 2 {
+		return nil, nil, resp.WrongArgs("BGSAVE")
+	}
+	if len(args) == 2 && !strings.EqualFold(args[1], "SCHEDULE") {
+		return nil, nil, resp.ErrSyntax
+	}
+	if err := DB.BGSave(); err != nil {
+		return nil, nil, resp.NewError("%s", err)
+	}
+	return resp.SimpleString("Background saving started"), nil, nil
+}
+
+func handleLastSave(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("LASTSAVE", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) != 1 {
+		return nil, nil, resp.WrongArgs("LASTSAVE")
+	}
+	return resp.Integer(DB.LastSave()), nil, nil
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/transaction"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
+)
+
+// scanOptions are the arguments of SCAN.
+type scanOptions struct {
+	cursor  uint64
+	pattern string
+	count   int
+	typ     string
+}
+
+// parseScanArgs parses cursor [MATCH pattern] [COUNT count] [TYPE type].
+func parseScanArgs(args []string) (scanOptions, error) {
+	cursor, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return scanOptions{}, resp.NewError("invalid cursor")
+	}
+	opts := scanOptions{cursor: cursor, pattern: "*", count: 10}
+	for i := 1; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return scanOptions{}, resp.ErrSyntax
+		}
+		value := args[i+1]
+		switch option := strings.ToUpper(args[i]); {
+		case option == "MATCH":
+			opts.pattern = value
+		case option == "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return scanOptions{}, resp.ErrNotInteger
+			}
+			if n < 1 {
+				return scanOptions{}, resp.ErrSyntax
+			}
+			opts.count = n
+		case option == "TYPE":
+			opts.typ = strings.ToLower(value)
+		default:
+			return scanOptions{}, resp.ErrSyntax
+		}
+	}
+	return opts, nil
+}
+
+// scanReply is the [cursor, [key ...]] reply of SCAN. Keys not matching
+// pattern are dropped here, after the scan, as in Redis.
+func scanReply(cursor uint64, pattern string, keys []string) resp.Value {
+	matching := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if pattern == "*" || utils.StringMatch(pattern, key, false) {
+			matching = append(matching, key)
+		}
+	}
+	return resp.Array{resp.BulkString(strconv.FormatUint(cursor, 10)), resp.BulkStrings(matching)}
+}
+
+// handleScan implements SCAN cursor [MATCH pattern] [COUNT count] [TYPE type].
+// Each call only holds the store lock for about count keys, unlike KEYS.
+func handleScan(args []string, DB *db.DB, activeTx *transaction.Transaction) (resp.Value, *transaction.Transaction, error) {
+	if activeTx != nil {
+		activeTx.AddCommand("SCAN", args[1:])
+		return resp.Queued, activeTx, nil
+	}
+	if len(args) < 2 {
+		return nil, nil, resp.WrongArgs("SCAN")
+	}
+	opts, err := parseScanArgs(args[1:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cursor, keys := DB.Scan(opts.cursor, opts.count, opts.typ)
+	return scanReply(cursor, opts.pattern, keys), nil, nil
+}
@@ -0,0 +1,116 @@
+// Package logger is the server log. It wraps log/slog with the Redis log
+// levels and the loglevel and logfile options. Subsystems attach their own
+// fields with With, e.g. the client id or a replica's address.
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync/atomic"
+)
+
+// Levels in increasing severity, as named in redis.conf. Notice and
+// warning line up with slog's Info and Warn.
+const (
+	LevelDebug   = slog.LevelDebug
+	LevelVerbose = slog.Level(-2)
+	LevelNotice  = slog.LevelInfo
+	LevelWarning = slog.LevelWarn
+)
+
+var levelNames = map[string]slog.Level{
+	"debug":   LevelDebug,
+	"verbose": LevelVerbose,
+	"notice":  LevelNotice,
+	"warning": LevelWarning,
+}
+
+var (
+	level   slog.LevelVar
+	current atomic.Pointer[slog.Logger]
+)
+
+func init() {
+	level.Set(LevelNotice)
+	current.Store(newLogger(os.Stdout))
+}
+
+func newLogger(w io.Writer) *slog.Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{
+		Level: &level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.LevelKey && len(groups) == 0 {
+				a.Value = slog.StringValue(levelName(a.Value.Any().(slog.Level)))
+			}
+			return a
+		},
+	}))
+}
+
+func levelName(l slog.Level) string {
+	switch {
+	case l < LevelVerbose:
+		return "debug"
+	case l < LevelNotice:
+		return "verbose"
+	case l < LevelWarning:
+		return "notice"
+	}
+	return "warning"
+}
+
+// Setup sends the log to path, appending to it, or to stdout when path is
+// empty. It should be called before any logger is derived with With.
+func Setup(path string) error {
+	if path == "" {
+		current.Store(newLogger(os.Stdout))
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	current.Store(newLogger(f))
+	return nil
+}
+
+// SetLevel changes the minimum level logged; it takes effect immediately,
+// including for loggers already derived with With.
+func SetLevel(name string) error {
+	l, ok := levelNames[name]
+	if !ok {
+		return fmt.Errorf("unknown log level %q", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+// With returns a logger that adds args to every record.
+func With(args ...any) *slog.Logger {
+	return current.Load().With(args...)
+}
+
+func Debug(msg string, args ...any) {
+	current.Load().Log(context.Background(), LevelDebug, msg, args...)
+}
+
+func Verbose(msg string, args ...any) {
+	current.Load().Log(context.Background(), LevelVerbose, msg, args...)
+}
+
+func Notice(msg string, args ...any) {
+	current.Load().Log(context.Background(), LevelNotice, msg, args...)
+}
+
+func Warning(msg string, args ...any) {
+	current.Load().Log(context.Background(), LevelWarning, msg, args...)
+}
+
+// Fatal logs at warning level and exits.
+func Fatal(msg string, args ...any) {
+	Warning(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,61 @@
+package output
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrLimit is returned once a queue has been closed for overcoming the
+// output buffer limit of its class.
+var ErrLimit = errors.New("output buffer limit reached")
+
+// Class is the client class whose client-output-buffer-limit applies to a
+// queue.
+type Class int
+
+const (
+	Normal Class = iota
+	Replica
+	PubSub
+)
+
+var classNames = [...]string{Normal: "normal", Replica: "replica", PubSub: "pubsub"}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+// Limit is one class of client-output-buffer-limit. A connection is closed
+// as soon as its pending output reaches Hard bytes, or once it stays at or
+// above Soft bytes for SoftSeconds. Zero disables a limit.
+type Limit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds int64
+}
+
+var limits [len(classNames)]atomic.Pointer[Limit]
+
+// SetLimit sets the limit of class, which applies to the queues of that
+// class from their next append on.
+func SetLimit(class Class, limit Limit) {
+	limits[class].Store(&limit)
+}
+
+// exceeded reports whether pending bytes are over the limit. softSince is
+// when the pending bytes reached the soft limit, kept by the caller.
+func (l *Limit) exceeded(pending int64, softSince *time.Time, now time.Time) bool {
+	if l.Hard > 0 && pending >= l.Hard {
+		return true
+	}
+	if l.Soft > 0 && pending >= l.Soft {
+		if softSince.IsZero() {
+			*softSince = now
+			return false
+		}
+		return now.Sub(*softSince) >= time.Duration(l.SoftSeconds)*time.Second
+	}
+	*softSince = time.Time{}
+	return false
+}
@@ -0,0 +1,80 @@
+package output
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestLimitExceeded(t *testing.T) {
+	start := time.Now()
+	limit := &Limit{Hard: 100, Soft: 50, SoftSeconds: 2}
+	var since time.Time
+
+	steps := []struct {
+		pending int64
+		after   time.Duration
+		want    bool
+	}{
+		{10, 0, false},
+		{60, 0, false}, // over the soft limit from now
+		{60, time.Second, false},
+		{10, time.Second, false}, // back under, which resets it
+		{60, 2 * time.Second, false},
+		{60, 4 * time.Second, true},
+		{100, 0, true},
+	}
+	for i, step := range steps {
+		if got := limit.exceeded(step.pending, &since, start.Add(step.after)); got != step.want {
+			t.Fatalf("step %d: exceeded(%d) = %v, want %v", i, step.pending, got, step.want)
+		}
+	}
+
+	if (&Limit{}).exceeded(1<<40, &since, start) {
+		t.Fatal("a zero limit was exceeded")
+	}
+}
+
+// A peer that never reads is disconnected once its queue reaches the hard
+// limit of its class.
+func TestQueueClosedOverLimit(t *testing.T) {
+	defer SetLimit(PubSub, Limit{})
+	SetLimit(PubSub, Limit{Hard: 1024})
+
+	server, client := net.Pipe()
+	defer client.Close()
+	q := New(server)
+	q.SetClass(PubSub)
+
+	message := make([]byte, 100)
+	var err error
+	for range 20 {
+		if _, err = q.Send(message); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrLimit) {
+		t.Fatalf("Send past the hard limit returned %v, want ErrLimit", err)
+	}
+	if _, err := client.Read(make([]byte, 1)); err == nil {
+		t.Fatal("the connection is still open")
+	}
+}
+
+// The limit of another class does not apply.
+func TestQueueLimitFollowsClass(t *testing.T) {
+	defer SetLimit(PubSub, Limit{})
+	SetLimit(PubSub, Limit{Hard: 1024})
+
+	server, client := net.Pipe()
+	defer client.Close()
+	q := New(server)
+	defer q.Abort()
+
+	for range 20 {
+		if _, err := q.Send(make([]byte, 100)); err != nil {
+			t.Fatalf("a normal client was held to the pubsub limit: %v", err)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package output
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/stats"
+)
+
+// closeTimeout bounds how long Close waits for a peer that stopped reading.
+const closeTimeout = 5 * time.Second
+
+// Queue owns the write side of a connection. Any goroutine may append
+// replies, pushes or replication traffic; a single writer goroutine is the
+// only one that ever calls conn.Write, so frames can never interleave.
+//
+// Appended data is held until Flush, which lets a command loop batch the
+// replies of a whole pipeline into one write. A queue whose pending bytes
+// overcome the limit of its class is closed, dropping what it holds.
+type Queue struct {
+	conn net.Conn
+
+	mu        sync.Mutex
+	class     Class
+	softSince time.Time // when the pending bytes reached the soft limit
+	cond      *sync.Cond
+	buf       []byte // appended, not yet handed to the writer
+	spare     []byte
+	flush     bool
+	writing   int64 // bytes handed to the writer and not yet written
+	peak      int64
+	closing   bool
+	closed    bool
+	err       error
+}
+
+func New(conn net.Conn) *Queue {
+	q := &Queue{conn: conn}
+	q.cond = sync.NewCond(&q.mu)
+	go q.writeLoop()
+	return q
+}
+
+// SetClass sets the client class whose output buffer limit the queue is
+// held to.
+func (q *Queue) SetClass(class Class) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.class = class
+	q.softSince = time.Time{}
+}
+
+// AppendValue encodes v at the end of the queue.
+func (q *Queue) AppendValue(v resp.Value, proto int) {
+	q.mu.Lock()
+	if q.closed || q.closing {
+		q.mu.Unlock()
+		return
+	}
+	q.buf = v.AppendTo(q.buf, proto)
+	q.appended()
+}
+
+// Append copies raw bytes, such as an already encoded command, to the end
+// of the queue.
+func (q *Queue) Append(data []byte) {
+	q.mu.Lock()
+	if q.closed || q.closing {
+		q.mu.Unlock()
+		return
+	}
+	q.buf = append(q.buf, data...)
+	q.appended()
+}
+
+// Send appends data, flushes, and returns the number of bytes waiting to be
+// written afterwards. It returns ErrLimit if that closed the queue.
+func (q *Queue) Send(data []byte) (int64, error) {
+	q.mu.Lock()
+	if q.closed || q.closing {
+		defer q.mu.Unlock()
+		return 0, q.closedErr()
+	}
+	q.buf = append(q.buf, data...)
+	q.flush = true
+	q.cond.Signal()
+	pending := int64(len(q.buf)) + q.writing
+	if !q.appended() {
+		return 0, ErrLimit
+	}
+	return pending, nil
+}
+
+// Flush hands everything appended so far to the writer goroutine. It
+// returns the error that stopped the writer, if any.
+func (q *Queue) Flush() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return q.closedErr()
+	}
+	if len(q.buf) > 0 {
+		q.flush = true
+		q.cond.Signal()
+	}
+	return nil
+}
+
+// Pending returns the bytes queued but not yet written to the socket, and
+// the highest value that has reached.
+func (q *Queue) Pending() (int64, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return int64(len(q.buf)) + q.writing, q.peak
+}
+
+// Close writes whatever is still queued and then closes the connection.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed || q.closing {
+		return
+	}
+	q.closing = true
+	q.flush = true
+	_ = q.conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+	q.cond.Signal()
+}
+
+// Abort discards queued data and closes the connection immediately.
+func (q *Queue) Abort() {
+	q.mu.Lock()
+	q.shutdown(net.ErrClosed)
+	q.mu.Unlock()
+	_ = q.conn.Close()
+}
+
+func (q *Queue) writeLoop() {
+	for {
+		q.mu.Lock()
+		for !q.closed && !(q.flush && len(q.buf) > 0) && !(q.closing && len(q.buf) == 0) {
+			q.cond.Wait()
+		}
+		if q.closed {
+			q.mu.Unlock()
+			return
+		}
+		if len(q.buf) == 0 {
+			// closing with nothing left to write
+			q.shutdown(net.ErrClosed)
+			q.mu.Unlock()
+			_ = q.conn.Close()
+			return
+		}
+		batch := q.buf
+		q.buf = q.spare[:0]
+		q.flush = q.closing
+		q.writing = int64(len(batch))
+		q.mu.Unlock()
+
+		n, err := q.conn.Write(batch)
+		stats.NetOutputBytes.Add(int64(n))
+
+		q.mu.Lock()
+		q.writing = 0
+		q.spare = batch
+		if err != nil || n < len(batch) {
+			q.shutdown(err)
+			q.mu.Unlock()
+			_ = q.conn.Close()
+			return
+		}
+		q.mu.Unlock()
+	}
+}
+
+// shutdown must be called with q.mu held.
+func (q *Queue) shutdown(err error) {
+	if q.closed {
+		return
+	}
+	q.closed = true
+	q.err = err
+	q.buf = nil
+	q.spare = nil
+	q.cond.Broadcast()
+}
+
+func (q *Queue) closedErr() error {
+	if q.err != nil {
+		return q.err
+	}
+	return net.ErrClosed
+}
+
+// appended must be called with q.mu held, after appending, and releases
+// it. It tracks the peak of the pending bytes and closes the queue if they
+// are over the limit of its class, reporting whether the queue is still
+// open.
+func (q *Queue) appended() bool {
+	pending := int64(len(q.buf)) + q.writing
+	q.peak = max(q.peak, pending)
+	limit := limits[q.class].Load()
+	if limit == nil || !limit.exceeded(pending, &q.softSince, time.Now()) {
+		q.mu.Unlock()
+		return true
+	}
+	q.shutdown(ErrLimit)
+	class := q.class
+	q.mu.Unlock()
+
+	logger.Warning("Client scheduled to be closed ASAP for overcoming of output buffer limits", "addr", q.conn.RemoteAddr().String(), "class", class.String(), "pending", pending)
+	_ = q.conn.Close()
+	return false
+}
@@ -0,0 +1,159 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
+)
+
+// frame encodes message seq of producer as a RESP array, with a payload
+// whose length varies so frames straddle the writes of the queue and the
+// reads of the peer.
+func frame(producer string, seq int) []string {
+	payload := strings.Repeat(string(rune('a'+seq%26)), (seq*997)%20000)
+	return []string{producer, strconv.Itoa(seq), payload}
+}
+
+// readFrames parses what the queue wrote until the connection closes and
+// checks that every frame is whole and that each producer's frames arrive
+// in order. It returns how many frames each producer got through.
+func readFrames(t *testing.T, conn net.Conn) map[string]int {
+	t.Helper()
+	got := map[string]int{}
+	r := resp.NewReader(conn)
+	for {
+		args, err := r.ReadCommand()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Errorf("frames interleaved or truncated: %v", err)
+			return got
+		}
+		if len(args) != 3 {
+			t.Errorf("frame with %d elements: %q", len(args), args)
+			return got
+		}
+		producer := args[0]
+		seq, err := strconv.Atoi(args[1])
+		if err != nil || seq != got[producer] {
+			t.Errorf("%s: got frame %s after %d frames", producer, args[1], got[producer])
+			return got
+		}
+		if want := frame(producer, seq); args[2] != want[2] {
+			t.Errorf("%s: frame %d has a corrupted payload", producer, seq)
+			return got
+		}
+		got[producer]++
+	}
+}
+
+// Pub/sub deliveries, command replies and replication traffic are queued on
+// one connection from different goroutines, as they are in the server. Run
+// with -race.
+func TestQueueConcurrentProducers(t *testing.T) {
+	const perProducer = 200
+	server, client := net.Pipe()
+	q := New(server)
+
+	results := make(chan map[string]int)
+	go func() { results <- readFrames(t, client) }()
+
+	var wg sync.WaitGroup
+	produce := func(name string, send func(seq int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for seq := range perProducer {
+				send(seq)
+			}
+		}()
+	}
+	for i := range 3 {
+		// A pub/sub delivery goroutine pushes each message on its own.
+		name := fmt.Sprintf("push%d", i)
+		produce(name, func(seq int) {
+			q.AppendValue(resp.Push{resp.BulkString(name), resp.BulkString(strconv.Itoa(seq)), resp.BulkString(frame(name, seq)[2])}, resp.RESP2)
+			q.Flush()
+		})
+	}
+	// The command loop batches replies and flushes once in a while.
+	produce("reply", func(seq int) {
+		q.AppendValue(resp.BulkStrings(frame("reply", seq)), resp.RESP2)
+		if seq%7 == 0 {
+			q.Flush()
+		}
+	})
+	for i := range 2 {
+		// Propagation queues already encoded commands.
+		name := fmt.Sprintf("replica%d", i)
+		produce(name, func(seq int) {
+			if seq%2 == 0 {
+				q.Send(resp.BulkStrings(frame(name, seq)).AppendTo(nil, resp.RESP2))
+			} else {
+				q.Append(resp.BulkStrings(frame(name, seq)).AppendTo(nil, resp.RESP2))
+				q.Flush()
+			}
+		})
+	}
+	wg.Wait()
+	q.Close()
+
+	got := <-results
+	for _, name := range []string{"push0", "push1", "push2", "reply", "replica0", "replica1"} {
+		if got[name] != perProducer {
+			t.Errorf("%s: %d of %d frames arrived", name, got[name], perProducer)
+		}
+	}
+}
+
+// Pending and Flush race with the writer goroutine as INFO and CLIENT LIST
+// read the output buffer of other clients.
+func TestQueuePendingWhileWriting(t *testing.T) {
+	server, client := net.Pipe()
+	q := New(server)
+	go io.Copy(io.Discard, client)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for seq := range 500 {
+			q.Send(resp.BulkStrings(frame("x", seq)).AppendTo(nil, resp.RESP2))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for range 500 {
+			if pending, peak := q.Pending(); pending < 0 || pending > peak {
+				t.Errorf("Pending() = %d, %d", pending, peak)
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	q.Close()
+}
+
+func TestQueueCloseWritesQueued(t *testing.T) {
+	server, client := net.Pipe()
+	q := New(server)
+	q.AppendValue(resp.BulkStrings(frame("a", 0)), resp.RESP2)
+	q.AppendValue(resp.BulkStrings(frame("a", 1)), resp.RESP2)
+	q.Close()
+	// Appends after Close are dropped rather than written.
+	q.AppendValue(resp.BulkStrings(frame("a", 2)), resp.RESP2)
+	if _, err := q.Send([]byte("+late\r\n")); err == nil {
+		t.Error("Send after Close succeeded")
+	}
+
+	if got := readFrames(t, client); got["a"] != 2 {
+		t.Fatalf("%d frames written before closing, want 2", got["a"])
+	}
+}
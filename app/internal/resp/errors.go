@@ -0,0 +1,75 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Error is an error reply. Code is the first word sent to the client, e.g.
+// "ERR", "WRONGTYPE" or "EXECABORT"; clients use it to classify failures.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Code + " " + e.Message
+}
+
+func (e *Error) AppendTo(buf []byte, proto int) []byte {
+	buf = append(buf, '-')
+	buf = append(buf, e.Code...)
+	buf = append(buf, ' ')
+	buf = append(buf, sanitizeError(e.Message)...)
+	return append(buf, '\r', '\n')
+}
+
+// NewError returns an error reply with the generic ERR code.
+func NewError(format string, a ...any) *Error {
+	return &Error{Code: "ERR", Message: fmt.Sprintf(format, a...)}
+}
+
+// NewCodeError returns an error reply with a specific code.
+func NewCodeError(code, format string, a ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, a...)}
+}
+
+// ToError converts any error into an error reply. Errors that do not carry
+// a code are reported as ERR.
+func ToError(err error) *Error {
+	var replyErr *Error
+	if errors.As(err, &replyErr) {
+		return replyErr
+	}
+	var protoErr *ProtocolError
+	if errors.As(err, &protoErr) {
+		return &Error{Code: "ERR", Message: protoErr.Error()}
+	}
+	return &Error{Code: "ERR", Message: err.Error()}
+}
+
+// WrongArgs is the arity error for a command.
+func WrongArgs(command string) *Error {
+	return NewError("wrong number of arguments for '%s' command", strings.ToLower(command))
+}
+
+var (
+	ErrWrongType  = NewCodeError("WRONGTYPE", "Operation against a key holding the wrong kind of value")
+	ErrSyntax     = NewError("syntax error")
+	ErrNotInteger = NewError("value is not an integer or out of range")
+	ErrOverflow   = NewError("increment or decrement would overflow")
+	ErrNoSuchKey  = NewError("no such key")
+	ErrDBIndex    = NewError("DB index is out of range")
+	ErrExecAbort  = NewCodeError("EXECABORT", "Transaction discarded because of previous errors.")
+	ErrOOM        = NewCodeError("OOM", "command not allowed when used memory > 'maxmemory'.")
+	ErrReadOnly   = NewCodeError("READONLY", "You can't write against a read only replica.")
+)
+
+// sanitizeError keeps an error reply on a single line.
+func sanitizeError(msg string) string {
+	if !strings.ContainsAny(msg, "\r\n") {
+		return msg
+	}
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(msg)
+}
@@ -0,0 +1,325 @@
+package resp
+
+import (
+	"bytes"
+	"io"
+	"sync/atomic"
+)
+
+const (
+	// MaxMultibulkLen caps the number of arguments in a single request.
+	MaxMultibulkLen = 1024 * 1024
+	// MaxInlineLen caps the size of an inline request or a length line.
+	MaxInlineLen = 64 * 1024
+
+	readBufferSize = 16 * 1024
+	// Buffers grown past this size for a large request are released once
+	// the request has been consumed.
+	maxIdleBufferSize = 4 * readBufferSize
+)
+
+var maxBulkLen atomic.Int64
+
+func init() {
+	maxBulkLen.Store(512 * 1024 * 1024)
+}
+
+// SetMaxBulkLen sets proto-max-bulk-len, the largest bulk string accepted
+// in a request.
+func SetMaxBulkLen(n int64) {
+	maxBulkLen.Store(n)
+}
+
+// MaxBulkLen returns the current proto-max-bulk-len.
+func MaxBulkLen() int64 {
+	return maxBulkLen.Load()
+}
+
+// ProtocolError is returned for malformed requests. The client should be
+// sent "-ERR <err>" and then disconnected.
+type ProtocolError struct {
+	Msg string
+}
+
+func (e *ProtocolError) Error() string {
+	return "Protocol error: " + e.Msg
+}
+
+func protocolError(msg string) error {
+	return &ProtocolError{Msg: msg}
+}
+
+// Reader reads client requests from a stream. It accepts both RESP
+// multibulk arrays and inline commands ("PING\r\n" typed into telnet).
+//
+// Requests are parsed in place from a buffer owned by the reader, and the
+// argument slices are reused from one request to the next, so reading a
+// command does not allocate. Arguments are only copied into strings when
+// Strings is called, once per request.
+type Reader struct {
+	rd io.Reader
+
+	buf  []byte
+	r, w int // unread data is buf[r:w]
+
+	spans   [][2]int // argument offsets relative to the request start
+	args    [][]byte
+	strs    []string
+	inline  bool
+	strings bool // strs holds the arguments of the last request
+	lastLen int
+}
+
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{rd: rd, buf: make([]byte, readBufferSize)}
+}
+
+// Buffered returns the number of bytes already read from the connection
+// but not yet parsed. Zero means the next read will block on the network,
+// which is when pending replies should be flushed.
+func (r *Reader) Buffered() int {
+	return r.w - r.r
+}
+
+// LastCommandSize returns how many bytes of the stream the last request
+// occupied, which is what a replica adds to its replication offset.
+func (r *Reader) LastCommandSize() int {
+	return r.lastLen
+}
+
+// ReadCommand reads the next request and returns it as strings. The
+// returned slice is reused by the next call, but the strings may be kept.
+func (r *Reader) ReadCommand() ([]string, error) {
+	if _, err := r.ReadArgs(); err != nil {
+		return nil, err
+	}
+	return r.Strings(), nil
+}
+
+// ReadArgs reads the next request. The returned arguments point into the
+// reader's buffer and are only valid until the next call. Empty requests (a
+// blank inline line, "*0" or "*-1") yield an empty, non-nil slice. io.EOF
+// is returned when the peer closes the connection between requests;
+// malformed input yields a *ProtocolError.
+func (r *Reader) ReadArgs() ([][]byte, error) {
+	r.reclaim()
+	if r.r == r.w {
+		if err := r.fill(); err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		n   int
+		err error
+	)
+	if r.buf[r.r] == '*' {
+		r.inline = false
+		n, err = r.parseMultibulk()
+	} else {
+		r.inline = true
+		n, err = r.parseInline()
+	}
+	r.strings = r.inline
+	if err != nil {
+		return nil, err
+	}
+
+	start := r.r
+	if !r.inline {
+		r.args = r.args[:0]
+		for _, span := range r.spans {
+			r.args = append(r.args, r.buf[start+span[0]:start+span[1]])
+		}
+	}
+	r.r += n
+	r.lastLen = n
+	return r.args, nil
+}
+
+// Strings returns the arguments of the last request as strings. They are
+// converted on the first call for a request, and the slice is reused from
+// one request to the next.
+func (r *Reader) Strings() []string {
+	if r.strings {
+		return r.strs
+	}
+	r.strs = r.strs[:0]
+	for _, arg := range r.args {
+		r.strs = append(r.strs, string(arg))
+	}
+	r.strings = true
+	return r.strs
+}
+
+// parseMultibulk parses a complete request starting at r.r and returns its
+// length. Arguments are recorded in r.spans as offsets from r.r, which stay
+// valid when fill moves the unread data around.
+func (r *Reader) parseMultibulk() (int, error) {
+	lineEnd, next, err := r.line(0, "too big mbulk count string")
+	if err != nil {
+		return 0, err
+	}
+	count, ok := parseInt(r.buf[r.r+1 : r.r+lineEnd])
+	if !ok || count > MaxMultibulkLen {
+		return 0, protocolError("invalid multibulk length")
+	}
+
+	r.spans = r.spans[:0]
+	pos := next
+	for i := int64(0); i < count; i++ {
+		lineEnd, next, err := r.line(pos, "too big bulk count string")
+		if err != nil {
+			return 0, err
+		}
+		if lineEnd == pos || r.buf[r.r+pos] != '$' {
+			got := "\\r"
+			if lineEnd > pos {
+				got = string(r.buf[r.r+pos])
+			}
+			return 0, protocolError("expected '$', got '" + got + "'")
+		}
+		length, ok := parseInt(r.buf[r.r+pos+1 : r.r+lineEnd])
+		if !ok || length < 0 || length > MaxBulkLen() {
+			return 0, protocolError("invalid bulk length")
+		}
+
+		end := next + int(length)
+		if err := r.need(end + 2); err != nil {
+			return 0, err
+		}
+		r.spans = append(r.spans, [2]int{next, end})
+		pos = end + 2
+	}
+	return pos, nil
+}
+
+func (r *Reader) parseInline() (int, error) {
+	lineEnd, next, err := r.line(0, "too big inline request")
+	if err != nil {
+		return 0, err
+	}
+	args, ok := SplitArgs(string(r.buf[r.r : r.r+lineEnd]))
+	if !ok {
+		return 0, protocolError("unbalanced quotes in request")
+	}
+	// Inline requests are meant for humans at a terminal, so they take the
+	// simple allocating path.
+	r.strs = append(r.strs[:0], args...)
+	r.args = r.args[:0]
+	for _, arg := range args {
+		r.args = append(r.args, []byte(arg))
+	}
+	return next, nil
+}
+
+// line finds the line starting at offset pos from r.r, reading more data as
+// needed. It returns the offset where the line's content ends (excluding
+// "\r\n" or a bare "\n") and the offset just past its terminator.
+func (r *Reader) line(pos int, tooBig string) (int, int, error) {
+	searched := pos
+	for {
+		if i := bytes.IndexByte(r.buf[r.r+searched:r.w], '\n'); i >= 0 {
+			nl := searched + i
+			end := nl
+			if end > pos && r.buf[r.r+end-1] == '\r' {
+				end--
+			}
+			return end, nl + 1, nil
+		}
+		searched = r.w - r.r
+		if searched-pos > MaxInlineLen {
+			return 0, 0, protocolError(tooBig)
+		}
+		if err := r.fill(); err != nil {
+			return 0, 0, unexpectedEOF(err, searched)
+		}
+	}
+}
+
+// need makes sure n bytes from r.r are buffered.
+func (r *Reader) need(n int) error {
+	for r.w-r.r < n {
+		if n > len(r.buf) {
+			grown := make([]byte, n)
+			r.w = copy(grown, r.buf[r.r:r.w])
+			r.r = 0
+			r.buf = grown
+		}
+		if err := r.fill(); err != nil {
+			return unexpectedEOF(err, r.w-r.r)
+		}
+	}
+	return nil
+}
+
+// fill reads more data, first moving unread bytes to the front of the
+// buffer and doubling it when it is full.
+func (r *Reader) fill() error {
+	if r.r > 0 {
+		r.w = copy(r.buf, r.buf[r.r:r.w])
+		r.r = 0
+	}
+	if r.w == len(r.buf) {
+		grown := make([]byte, 2*len(r.buf))
+		copy(grown, r.buf[:r.w])
+		r.buf = grown
+	}
+	n, err := r.rd.Read(r.buf[r.w:])
+	r.w += n
+	if n > 0 {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return err
+}
+
+// reclaim drops a buffer that was grown for an unusually large request
+// once nothing is left in it.
+func (r *Reader) reclaim() {
+	if r.r == r.w {
+		r.r, r.w = 0, 0
+		if len(r.buf) > maxIdleBufferSize {
+			r.buf = make([]byte, readBufferSize)
+		}
+	}
+}
+
+// parseInt parses a decimal integer without allocating.
+func parseInt(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 20 {
+		return 0, false
+	}
+	negative := b[0] == '-'
+	if negative {
+		b = b[1:]
+		if len(b) == 0 {
+			return 0, false
+		}
+	}
+	var n int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+		if n < 0 {
+			return 0, false
+		}
+	}
+	if negative {
+		n = -n
+	}
+	return n, true
+}
+
+// unexpectedEOF converts io.EOF in the middle of a request into
+// io.ErrUnexpectedEOF so callers can tell it apart from a clean close.
+func unexpectedEOF(err error, buffered int) error {
+	if err == io.EOF && buffered > 0 {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
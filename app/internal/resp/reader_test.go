@@ -0,0 +1,282 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkReader returns at most n bytes per Read, like a connection that
+// delivers a request in several segments.
+type chunkReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	return c.r.Read(p[:min(len(p), c.n)])
+}
+
+// readAll reads requests until an error and returns them with the error.
+func readAll(rd io.Reader) ([][]string, error) {
+	r := NewReader(rd)
+	var commands [][]string
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			return commands, err
+		}
+		commands = append(commands, append([]string{}, args...))
+	}
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  [][]string
+		err   string // a protocol error message, or the text of another error
+	}{
+		{"inline", "PING\r\n", [][]string{{"PING"}}, "EOF"},
+		{"inline bare newline", "ECHO hi\n", [][]string{{"ECHO", "hi"}}, "EOF"},
+		{"inline quotes", "SET \"a b\" 'c d' \"\\x41\\n\"\r\n", [][]string{{"SET", "a b", "c d", "A\n"}}, "EOF"},
+		{"blank inline", "\r\n", [][]string{{}}, "EOF"},
+		{"null multibulk", "*-1\r\n", [][]string{{}}, "EOF"},
+		{"empty multibulk", "*0\r\n", [][]string{{}}, "EOF"},
+		{"multibulk", "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", [][]string{{"GET", "k"}}, "EOF"},
+		{"binary bulk", "*2\r\n$4\r\nECHO\r\n$4\r\na\r\nb\r\n", [][]string{{"ECHO", "a\r\nb"}}, "EOF"},
+		{"empty bulk", "*2\r\n$4\r\nECHO\r\n$0\r\n\r\n", [][]string{{"ECHO", ""}}, "EOF"},
+		{"pipeline", "*1\r\n$4\r\nPING\r\nPING\r\n*1\r\n$4\r\nPING\r\n", [][]string{{"PING"}, {"PING"}, {"PING"}}, "EOF"},
+		{"oversized bulk length", "*1\r\n$536870913\r\n", nil, "invalid bulk length"},
+		{"negative bulk length", "*1\r\n$-1\r\n", nil, "invalid bulk length"},
+		{"multibulk count over limit", fmt.Sprintf("*%d\r\n", MaxMultibulkLen+1), nil, "invalid multibulk length"},
+		{"invalid multibulk count", "*x\r\n", nil, "invalid multibulk length"},
+		{"missing dollar", "*1\r\n+OK\r\n", nil, "expected '$', got '+'"},
+		{"empty bulk header", "*1\r\n\r\n", nil, "expected '$', got '\\r'"},
+		{"unbalanced double quote", "SET \"a\r\n", nil, "unbalanced quotes in request"},
+		{"unbalanced single quote", "SET 'a\r\n", nil, "unbalanced quotes in request"},
+		{"text after closing quote", "SET \"a\"b\r\n", nil, "unbalanced quotes in request"},
+		{"inline too big", strings.Repeat("a", MaxInlineLen+2), nil, "too big inline request"},
+		{"count line too big", "*" + strings.Repeat("1", MaxInlineLen+2), nil, "too big mbulk count string"},
+		{"truncated bulk", "*1\r\n$5\r\nab", nil, io.ErrUnexpectedEOF.Error()},
+		{"truncated header", "*2\r\n$3\r\nGET\r\n", nil, io.ErrUnexpectedEOF.Error()},
+	}
+
+	for _, tt := range tests {
+		for _, chunk := range []int{len(tt.input), 3, 1} {
+			t.Run(fmt.Sprintf("%s/%d", tt.name, chunk), func(t *testing.T) {
+				got, err := readAll(&chunkReader{strings.NewReader(tt.input), max(chunk, 1)})
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("commands = %q, want %q", got, tt.want)
+				}
+				msg := fmt.Sprint(err)
+				var protoErr *ProtocolError
+				if errors.As(err, &protoErr) {
+					msg = protoErr.Msg
+				}
+				if msg != tt.err {
+					t.Errorf("error = %q, want %q", msg, tt.err)
+				}
+			})
+		}
+	}
+}
+
+// Arguments returned by ReadArgs are only valid until the next call, but
+// the strings of ReadCommand may be kept.
+func TestReaderStringsOutliveBuffer(t *testing.T) {
+	r := NewReader(strings.NewReader("*1\r\n$3\r\nabc\r\n*1\r\n$3\r\nxyz\r\n"))
+	first, err := r.ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := first[0]
+	if _, err := r.ReadCommand(); err != nil {
+		t.Fatal(err)
+	}
+	if kept != "abc" {
+		t.Fatalf("kept argument changed to %q", kept)
+	}
+}
+
+func TestReaderStringsOncePerRequest(t *testing.T) {
+	r := NewReader(&repeatReader{data: []byte("*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n")})
+	if _, err := r.ReadArgs(); err != nil {
+		t.Fatal(err)
+	}
+	first := r.Strings()
+	if allocs := testing.AllocsPerRun(10, func() { r.Strings() }); allocs != 0 {
+		t.Fatalf("Strings allocated %v times once converted", allocs)
+	}
+	if !reflect.DeepEqual(first, []string{"GET", "key"}) {
+		t.Fatalf("Strings = %q", first)
+	}
+}
+
+func TestReaderLastCommandSize(t *testing.T) {
+	commands := []string{"*1\r\n$4\r\nPING\r\n", "PING\r\n", "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n"}
+	r := NewReader(strings.NewReader(strings.Join(commands, "")))
+	for _, command := range commands {
+		if _, err := r.ReadArgs(); err != nil {
+			t.Fatal(err)
+		}
+		if r.LastCommandSize() != len(command) {
+			t.Fatalf("LastCommandSize = %d for %q", r.LastCommandSize(), command)
+		}
+	}
+}
+
+func TestReaderBulkOverMaxBulkLen(t *testing.T) {
+	defer SetMaxBulkLen(MaxBulkLen())
+	SetMaxBulkLen(3)
+	_, err := readAll(strings.NewReader("*1\r\n$3\r\nabc\r\n*1\r\n$4\r\nabcd\r\n"))
+	var protoErr *ProtocolError
+	if !errors.As(err, &protoErr) || protoErr.Msg != "invalid bulk length" {
+		t.Fatalf("error = %v, want invalid bulk length", err)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+		ok   bool
+	}{
+		{"", []string{}, true},
+		{"   ", []string{}, true},
+		{"set  key\tvalue ", []string{"set", "key", "value"}, true},
+		{`"" ''`, []string{"", ""}, true},
+		{`"a\"b" 'c\'d'`, []string{`a"b`, "c'd"}, true},
+		{`"\n\r\t\b\a\\"`, []string{"\n\r\t\b\a\\"}, true},
+		{`"\x41\x6a\xzz"`, []string{"Ajxzz"}, true}, // an invalid escape keeps the letter
+		{`'\n'`, []string{`\n`}, true},
+		{`"unterminated`, nil, false},
+		{`'unterminated`, nil, false},
+		{`"a"b`, nil, false},
+		{`'a'b`, nil, false},
+	}
+	for _, tt := range tests {
+		got, ok := SplitArgs(tt.line)
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, %v; want %q, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+// FuzzReadArgs checks that the reader never panics and that how the input
+// is split across reads does not change what it parses.
+func FuzzReadArgs(f *testing.F) {
+	for _, seed := range []string{
+		"PING\r\n",
+		"SET \"a b\" 'c'\r\n",
+		"*-1\r\n*0\r\n",
+		"*2\r\n$3\r\nGET\r\n$1\r\nk\r\n",
+		"*1\r\n$536870913\r\n",
+		"*1\r\n$5\r\nab",
+		"SET \"a\r\n",
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, input []byte) {
+		whole, wholeErr := readAll(bytes.NewReader(input))
+		split, splitErr := readAll(iotest.OneByteReader(bytes.NewReader(input)))
+		if !reflect.DeepEqual(whole, split) {
+			t.Fatalf("split reads parsed %q, whole reads %q", split, whole)
+		}
+		if fmt.Sprint(wholeErr) != fmt.Sprint(splitErr) {
+			t.Fatalf("split reads failed with %v, whole reads with %v", splitErr, wholeErr)
+		}
+	})
+}
+
+// repeatReader serves data over and over, so a benchmark can read as many
+// requests as it needs from one pipeline.
+type repeatReader struct {
+	data []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.off:])
+	r.off = (r.off + n) % len(r.data)
+	return n, nil
+}
+
+// parseArgs is the ParseArgs the Reader replaced, kept as the baseline of
+// BenchmarkReadArgs without its logging.
+func parseArgs(reader *bufio.Reader) []string {
+	line, err := reader.ReadString('\n')
+	if err != nil || len(line) < 2 || line[0] != '*' {
+		return nil
+	}
+	var arrayLength int
+	if _, err := fmt.Sscanf(line, "*%d\r\n", &arrayLength); err != nil {
+		return nil
+	}
+	args := make([]string, arrayLength)
+	for i := 0; i < arrayLength; i++ {
+		lengthLine, err := reader.ReadString('\n')
+		if err != nil || len(lengthLine) < 2 || lengthLine[0] != '$' {
+			return nil
+		}
+		var strLen int
+		if _, err := fmt.Sscanf(lengthLine, "$%d\r\n", &strLen); err != nil {
+			return nil
+		}
+		arg := make([]byte, strLen+2)
+		if _, err := io.ReadFull(reader, arg); err != nil {
+			return nil
+		}
+		args[i] = string(arg[:strLen])
+	}
+	return args
+}
+
+// BenchmarkReadArgs reads SET requests from a pipeline with ReadArgs, with
+// ReadCommand, which also makes strings of the arguments, and with the old
+// ParseArgs.
+func BenchmarkReadArgs(b *testing.B) {
+	var pipeline []byte
+	for i := range 256 {
+		key := fmt.Sprintf("key:%d", i)
+		pipeline = fmt.Appendf(pipeline, "*3\r\n$3\r\nSET\r\n$%d\r\n%s\r\n$16\r\n%s\r\n", len(key), key, strings.Repeat("v", 16))
+	}
+	perRequest := int64(len(pipeline) / 256)
+
+	b.Run("ReadArgs", func(b *testing.B) {
+		r := NewReader(&repeatReader{data: pipeline})
+		b.SetBytes(perRequest)
+		b.ReportAllocs()
+		for range b.N {
+			if args, err := r.ReadArgs(); err != nil || len(args) != 3 {
+				b.Fatal(args, err)
+			}
+		}
+	})
+	b.Run("ReadCommand", func(b *testing.B) {
+		r := NewReader(&repeatReader{data: pipeline})
+		b.SetBytes(perRequest)
+		b.ReportAllocs()
+		for range b.N {
+			if args, err := r.ReadCommand(); err != nil || len(args) != 3 {
+				b.Fatal(args, err)
+			}
+		}
+	})
+	b.Run("ParseArgs", func(b *testing.B) {
+		r := bufio.NewReader(&repeatReader{data: pipeline})
+		b.SetBytes(perRequest)
+		b.ReportAllocs()
+		for range b.N {
+			if args := parseArgs(r); len(args) != 3 {
+				b.Fatal(args)
+			}
+		}
+	})
+}
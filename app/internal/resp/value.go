@@ -0,0 +1,204 @@
+package resp
+
+import (
+	"math"
+	"strconv"
+)
+
+// Protocol versions negotiated with HELLO.
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
+// Value is a reply that knows how to encode itself for either protocol
+// version. RESP3-only types fall back to their closest RESP2 shape.
+type Value interface {
+	AppendTo(buf []byte, proto int) []byte
+}
+
+// Encode returns the wire form of v for the given protocol version.
+func Encode(v Value, proto int) []byte {
+	return v.AppendTo(nil, proto)
+}
+
+type SimpleString string
+
+func (s SimpleString) AppendTo(buf []byte, proto int) []byte {
+	buf = append(buf, '+')
+	buf = append(buf, s...)
+	return append(buf, '\r', '\n')
+}
+
+type BulkString string
+
+func (s BulkString) AppendTo(buf []byte, proto int) []byte {
+	buf = appendHeader(buf, '$', len(s))
+	buf = append(buf, s...)
+	return append(buf, '\r', '\n')
+}
+
+type Integer int64
+
+func (i Integer) AppendTo(buf []byte, proto int) []byte {
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(i), 10)
+	return append(buf, '\r', '\n')
+}
+
+// Double is sent as ",<float>" in RESP3 and as a bulk string in RESP2.
+type Double float64
+
+func (d Double) AppendTo(buf []byte, proto int) []byte {
+	text := formatDouble(float64(d))
+	if proto < RESP3 {
+		return BulkString(text).AppendTo(buf, proto)
+	}
+	buf = append(buf, ',')
+	buf = append(buf, text...)
+	return append(buf, '\r', '\n')
+}
+
+func formatDouble(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case math.IsNaN(f):
+		return "nan"
+	}
+	return strconv.FormatFloat(f, 'g', 17, 64)
+}
+
+// Boolean is sent as "#t"/"#f" in RESP3 and as :1/:0 in RESP2.
+type Boolean bool
+
+func (b Boolean) AppendTo(buf []byte, proto int) []byte {
+	if proto < RESP3 {
+		if b {
+			return Integer(1).AppendTo(buf, proto)
+		}
+		return Integer(0).AppendTo(buf, proto)
+	}
+	if b {
+		return append(buf, "#t\r\n"...)
+	}
+	return append(buf, "#f\r\n"...)
+}
+
+// Null is the RESP3 null; RESP2 clients receive a null bulk string.
+type Null struct{}
+
+func (Null) AppendTo(buf []byte, proto int) []byte {
+	if proto < RESP3 {
+		return append(buf, "$-1\r\n"...)
+	}
+	return append(buf, "_\r\n"...)
+}
+
+// NullArray is the RESP3 null; RESP2 clients receive a null array.
+type NullArray struct{}
+
+func (NullArray) AppendTo(buf []byte, proto int) []byte {
+	if proto < RESP3 {
+		return append(buf, "*-1\r\n"...)
+	}
+	return append(buf, "_\r\n"...)
+}
+
+type Array []Value
+
+func (a Array) AppendTo(buf []byte, proto int) []byte {
+	return appendAggregate(buf, '*', a, proto)
+}
+
+// Set is sent as "~" in RESP3 and as a plain array in RESP2.
+type Set []Value
+
+func (s Set) AppendTo(buf []byte, proto int) []byte {
+	if proto < RESP3 {
+		return appendAggregate(buf, '*', s, proto)
+	}
+	return appendAggregate(buf, '~', s, proto)
+}
+
+// Push is an out-of-band message such as a pub/sub delivery. RESP2 clients
+// receive it as a plain array.
+type Push []Value
+
+func (p Push) AppendTo(buf []byte, proto int) []byte {
+	if proto < RESP3 {
+		return appendAggregate(buf, '*', p, proto)
+	}
+	return appendAggregate(buf, '>', p, proto)
+}
+
+// KeyValue is a single Map entry.
+type KeyValue struct {
+	Key   Value
+	Value Value
+}
+
+// Map keeps its insertion order. RESP2 clients receive a flat array of
+// alternating keys and values.
+type Map []KeyValue
+
+func (m Map) AppendTo(buf []byte, proto int) []byte {
+	if proto < RESP3 {
+		buf = appendHeader(buf, '*', len(m)*2)
+	} else {
+		buf = appendHeader(buf, '%', len(m))
+	}
+	for _, kv := range m {
+		buf = kv.Key.AppendTo(buf, proto)
+		buf = kv.Value.AppendTo(buf, proto)
+	}
+	return buf
+}
+
+// Verbatim is a string with a three letter format hint ("txt" or "mkd").
+// RESP2 clients receive a plain bulk string.
+type Verbatim struct {
+	Format string
+	Text   string
+}
+
+func (v Verbatim) AppendTo(buf []byte, proto int) []byte {
+	if proto < RESP3 {
+		return BulkString(v.Text).AppendTo(buf, proto)
+	}
+	buf = appendHeader(buf, '=', len(v.Format)+1+len(v.Text))
+	buf = append(buf, v.Format...)
+	buf = append(buf, ':')
+	buf = append(buf, v.Text...)
+	return append(buf, '\r', '\n')
+}
+
+// BulkStrings is a convenience for the common array-of-strings reply.
+func BulkStrings(items []string) Array {
+	arr := make(Array, len(items))
+	for i, item := range items {
+		arr[i] = BulkString(item)
+	}
+	return arr
+}
+
+func appendAggregate[T ~[]Value](buf []byte, prefix byte, items T, proto int) []byte {
+	buf = appendHeader(buf, prefix, len(items))
+	for _, item := range items {
+		buf = item.AppendTo(buf, proto)
+	}
+	return buf
+}
+
+func appendHeader(buf []byte, prefix byte, n int) []byte {
+	buf = append(buf, prefix)
+	buf = strconv.AppendInt(buf, int64(n), 10)
+	return append(buf, '\r', '\n')
+}
+
+var (
+	OK     = SimpleString("OK")
+	Queued = SimpleString("QUEUED")
+)
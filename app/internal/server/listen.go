@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// listenTCP opens a listener on every address in bind, which is a space
+// separated list as in redis.conf: "*" is every IPv4 address, "::*" every
+// IPv6 address, and a leading "-" marks an address that may be unavailable
+// (for instance IPv6 on a host without it) without failing startup.
+//
+// A non-nil tlsConfig wraps the listeners in TLS. Keepalive is left to
+// serve, which applies the current tcp-keepalive to each connection.
+func listenTCP(bind, port string, tlsConfig *tls.Config) ([]net.Listener, error) {
+	lc := net.ListenConfig{KeepAlive: -1}
+
+	var listeners []net.Listener
+	for _, addr := range strings.Fields(bind) {
+		optional := strings.HasPrefix(addr, "-")
+		addr = strings.TrimPrefix(addr, "-")
+
+		network := "tcp4"
+		switch {
+		case addr == "*":
+			addr = "0.0.0.0"
+		case addr == "::*":
+			addr = "::"
+			network = "tcp6"
+		case strings.Contains(addr, ":"):
+			network = "tcp6"
+		}
+
+		l, err := lc.Listen(context.Background(), network, net.JoinHostPort(addr, port))
+		if err != nil {
+			if optional {
+				continue
+			}
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("could not bind %s: %w", net.JoinHostPort(addr, port), err)
+		}
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("could not bind any of %q", bind)
+	}
+	return listeners, nil
+}
@@ -2,68 +2,261 @@ package server
 
 import (
 	"bufio"
-	"fmt"
+	"crypto/tls"
+	"errors"
 	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
 
+	"github.com/codecrafters-io/redis-starter-go/app/internal/config"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/db"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/handlers"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/output"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/resp"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/utils"
 )
 
-func Start(port, replicaof, dir, dbFileName string) {
-	l, err := net.Listen("tcp", "0.0.0.0:"+port)
-	if err != nil {
-		fmt.Println("Failed to bind to port", port)
-		os.Exit(1)
+// keepAlive is tcp-keepalive in nanoseconds, applied to each accepted
+// connection so that CONFIG SET affects new clients.
+var keepAlive atomic.Int64
+
+func Start(cfg *config.Config) {
+	if err := logger.Setup(cfg.Get("logfile")); err != nil {
+		logger.Fatal("Can't open the log file", "logfile", cfg.Get("logfile"), "err", err)
 	}
-	defer l.Close()
 
-	fmt.Println("Server listening on port", port)
+	port := cfg.Get("port")
+	tlsPort := cfg.Get("tls-port")
+	tlsEnabled := tlsPort != "0"
+	tlsReplication := cfg.Bool("tls-replication")
+
+	var serverTLS, masterTLS *tls.Config
+	if tlsEnabled || tlsReplication {
+		var err error
+		serverTLS, masterTLS, err = tlsConfigs(cfg)
+		if err != nil {
+			logger.Fatal("Failed to configure TLS", "err", err)
+		}
+		if !tlsReplication {
+			masterTLS = nil
+		}
+	}
 
 	role := "master"
-	if replicaof != "" {
+	if cfg.Get("replicaof") != "" {
 		role = "slave"
 	}
-	database := db.New(role)
-	database.RDBFileDir = dir
-	database.RDBFileName = dbFileName
+	database := db.New(role, int(cfg.Int("databases")))
+	database.Config = cfg
+	registerLiveConfig(cfg, database)
+	if err := cfg.Apply(); err != nil {
+		logger.Fatal("Invalid configuration", "err", err)
+	}
 
-	if err := database.ParseAndLoadRDBFile(); err != nil {
-		fmt.Println("Failed to load RDB file:", err)
-		os.Exit(1)
+	var listeners []net.Listener
+	if port != "0" {
+		tcpListeners, err := listenTCP(cfg.Get("bind"), port, nil)
+		if err != nil {
+			logger.Fatal("Failed to bind to port", "port", port, "err", err)
+		}
+		logger.Notice("Ready to accept connections tcp", "port", port)
+		listeners = append(listeners, tcpListeners...)
 	}
+	if tlsEnabled {
+		tlsListeners, err := listenTCP(cfg.Get("bind"), tlsPort, serverTLS)
+		if err != nil {
+			logger.Fatal("Failed to bind to TLS port", "port", tlsPort, "err", err)
+		}
+		logger.Notice("Ready to accept connections tls", "port", tlsPort)
+		listeners = append(listeners, tlsListeners...)
+	}
+	if unixSocket := cfg.Get("unixsocket"); unixSocket != "" {
+		l, err := listenUnix(unixSocket, cfg.Get("unixsocketperm"))
+		if err != nil {
+			logger.Fatal("Failed to listen on unix socket", "path", unixSocket, "err", err)
+		}
+		logger.Notice("Ready to accept connections unix", "path", unixSocket)
+		listeners = append(listeners, l)
+	}
+	if len(listeners) == 0 {
+		logger.Fatal("No listeners configured: set port, tls-port or unixsocket")
+	}
+	if metricsPort := cfg.Get("metrics-port"); metricsPort != "0" {
+		metricsListeners, err := listenTCP(cfg.Get("bind"), metricsPort, nil)
+		if err != nil {
+			logger.Fatal("Failed to bind to metrics port", "port", metricsPort, "err", err)
+		}
+		logger.Notice("Serving metrics over http", "port", metricsPort)
+		for _, l := range metricsListeners {
+			go http.Serve(l, handlers.MetricsHandler(database))
+		}
+	}
+	for _, l := range listeners {
+		defer l.Close()
+	}
+	shutdownOnSignal(listeners)
 
+	if err := database.ParseAndLoadRDBFile(); err != nil {
+		logger.Fatal("Failed to load RDB file", "err", err)
+	}
+	database.StartActiveExpire()
 
 	if role == "slave" {
-		masterAddr := utils.ParsReplicaOf(replicaof)
+		masterAddr := utils.ParsReplicaOf(cfg.Get("replicaof"))
 		if masterAddr == "" {
 			return
 		}
-		fmt.Printf("Connecting to master at %s...\n", masterAddr)
+		logger.Notice("Connecting to MASTER", "master", masterAddr)
+		database.Replication.MasterHost, database.Replication.MasterPort, _ = net.SplitHostPort(masterAddr)
 
-		conn, err := net.Dial("tcp", masterAddr)
+		conn, err := dialMaster(masterAddr, masterTLS)
 		if err != nil {
-			fmt.Println("Failed to connect to master:", err.Error())
-			os.Exit(1)
+			logger.Fatal("Failed to connect to MASTER", "master", masterAddr, "err", err)
 		}
 		// Create a single reader for the master connection.
 		reader := bufio.NewReader(conn)
 
+		// The master reaches us back on the port matching the link's transport.
+		listeningPort := port
+		if masterTLS != nil && tlsEnabled {
+			listeningPort = tlsPort
+		}
 		// Pass the reader to the handshake function.
-		if err := handlers.HandshakeWithMaster(conn, reader, port); err != nil {
-			fmt.Println("Handshake with master failed:", err.Error())
-			os.Exit(1)
+		if err := handlers.HandshakeWithMaster(conn, reader, listeningPort); err != nil {
+			logger.Fatal("Handshake with MASTER failed", "master", masterAddr, "err", err)
 		}
 		// Pass the same reader to the connection handler.
 		go handlers.HandleMasterConnection(conn, database, reader)
 	}
+	for _, l := range listeners[1:] {
+		go serve(l, database)
+	}
+	serve(listeners[0], database)
+}
+
+// registerLiveConfig connects the parameters that CONFIG SET may change to
+// the running server.
+func registerLiveConfig(cfg *config.Config, database *db.DB) {
+	cfg.OnChange("dir", func(value string) error {
+		info, err := os.Stat(value)
+		if err != nil {
+			return errors.New("No such file or directory")
+		}
+		if !info.IsDir() {
+			return errors.New("Not a directory")
+		}
+		return nil
+	})
+	cfg.OnChange("dbfilename", func(value string) error {
+		if value != filepath.Base(value) {
+			return errors.New("dbfilename can't be a path, just a filename")
+		}
+		return nil
+	})
+	cfg.OnChange("proto-max-bulk-len", func(value string) error {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		resp.SetMaxBulkLen(n)
+		return nil
+	})
+	cfg.OnChange("client-output-buffer-limit", func(value string) error {
+		limits, err := config.OutputBufferLimits(value)
+		if err != nil {
+			return err
+		}
+		for _, class := range []output.Class{output.Normal, output.Replica, output.PubSub} {
+			l := limits[class.String()]
+			output.SetLimit(class, output.Limit{Hard: l[0], Soft: l[1], SoftSeconds: l[2]})
+		}
+		return nil
+	})
+	cfg.OnChange("tcp-keepalive", func(value string) error {
+		seconds, _ := strconv.ParseInt(value, 10, 64)
+		keepAlive.Store(int64(time.Duration(seconds) * time.Second))
+		return nil
+	})
+	cfg.OnChange("maxclients", func(value string) error {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		handlers.SetMaxClients(n)
+		return nil
+	})
+	cfg.OnChange("hz", func(value string) error {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		database.SetHz(n)
+		return nil
+	})
+	cfg.OnChange("maxmemory", func(value string) error {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		database.SetMaxMemory(n)
+		// Evicting locks shards, which a CONFIG SET inside EXEC may hold.
+		go func() {
+			if err := database.EnforceMaxMemory(); err != nil {
+				logger.Warning("The new maxmemory is smaller than the memory used by the keys, writes will be refused", "maxmemory", n, "used", database.UsedMemory())
+			}
+		}()
+		return nil
+	})
+	cfg.OnChange("maxmemory-policy", func(value string) error {
+		database.SetEvictionPolicy(value)
+		return nil
+	})
+	cfg.OnChange("maxmemory-samples", func(value string) error {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		database.SetEvictionSamples(n)
+		return nil
+	})
+	cfg.OnChange("lfu-log-factor", func(value string) error {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		db.SetLFULogFactor(n)
+		return nil
+	})
+	cfg.OnChange("lfu-decay-time", func(value string) error {
+		n, _ := strconv.ParseInt(value, 10, 64)
+		db.SetLFUDecayTime(n)
+		return nil
+	})
+	cfg.OnChange("loglevel", logger.SetLevel)
+	cfg.OnChange("timeout", func(value string) error {
+		seconds, _ := strconv.ParseInt(value, 10, 64)
+		handlers.SetIdleTimeout(time.Duration(seconds) * time.Second)
+		return nil
+	})
+}
+
+// serve accepts connections from l. TCP, TLS and Unix socket clients share
+// the same HandleConnection path.
+func serve(l net.Listener, database *db.DB) {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			fmt.Println("Error accepting connection:", err.Error())
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Warning("Accepting client connection failed", "err", err)
 			continue
 		}
+		setKeepAlive(conn)
 		go handlers.HandleConnection(conn, database)
 	}
-}
\ No newline at end of file
+}
+
+func setKeepAlive(conn net.Conn) {
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		conn = tlsConn.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	period := time.Duration(keepAlive.Load())
+	if period <= 0 {
+		tcpConn.SetKeepAlive(false)
+		return
+	}
+	tcpConn.SetKeepAlive(true)
+	tcpConn.SetKeepAlivePeriod(period)
+}
@@ -0,0 +1,76 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/config"
+)
+
+// tlsConfigs builds the server side configuration used by the TLS listener
+// and the client side one used to dial a master with tls-replication.
+func tlsConfigs(cfg *config.Config) (*tls.Config, *tls.Config, error) {
+	certFile, keyFile, caCertFile := cfg.Get("tls-cert-file"), cfg.Get("tls-key-file"), cfg.Get("tls-ca-cert-file")
+	if certFile == "" || keyFile == "" {
+		return nil, nil, errors.New("tls-cert-file and tls-key-file are required")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	var caPool *x509.CertPool
+	if caCertFile != "" {
+		pem, err := os.ReadFile(caCertFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read tls-ca-cert-file: %w", err)
+		}
+		caPool = x509.NewCertPool()
+		if !caPool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", caCertFile)
+		}
+	}
+
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    caPool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	switch cfg.Get("tls-auth-clients") {
+	case "yes":
+		serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		serverConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "no":
+		serverConfig.ClientAuth = tls.NoClientCert
+	}
+	if serverConfig.ClientAuth != tls.NoClientCert && caPool == nil {
+		return nil, nil, errors.New("tls-auth-clients requires tls-ca-cert-file")
+	}
+
+	// Like Redis, the replica presents its own certificate to the master.
+	clientConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	return serverConfig, clientConfig, nil
+}
+
+// dialMaster connects to the master, over TLS when tls-replication is on.
+func dialMaster(addr string, clientConfig *tls.Config) (net.Conn, error) {
+	if clientConfig == nil {
+		return net.Dial("tcp", addr)
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	config := clientConfig.Clone()
+	config.ServerName = host
+	return tls.Dial("tcp", addr, config)
+}
@@ -0,0 +1,317 @@
+package server
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/config"
+)
+
+// testPKI is a CA and a certificate it signed for 127.0.0.1, written to PEM
+// files. Like a server's certificate, it serves both as a server and as a
+// client certificate when replicating.
+type testPKI struct {
+	caFile, certFile, keyFile string
+	cert                      tls.Certificate
+	pool                      *x509.CertPool
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, caCert, caDER := newCertificate(t, "test CA", nil, nil)
+	key, _, der := newCertificate(t, "127.0.0.1", caCert, caKey)
+
+	p := &testPKI{
+		caFile:   filepath.Join(dir, "ca.crt"),
+		certFile: filepath.Join(dir, "redis.crt"),
+		keyFile:  filepath.Join(dir, "redis.key"),
+		pool:     x509.NewCertPool(),
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, p.caFile, "CERTIFICATE", caDER)
+	writePEM(t, p.certFile, "CERTIFICATE", der)
+	writePEM(t, p.keyFile, "EC PRIVATE KEY", keyDER)
+	p.pool.AddCert(caCert)
+	p.cert = tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	return p
+}
+
+// newCertificate creates a certificate for name signed by parent, or a CA
+// certificate signing itself if parent is nil.
+func newCertificate(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*ecdsa.PrivateKey, *x509.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		template.IPAddresses = []net.IP{net.IPv4(127, 0, 0, 1)}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert, der
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tlsTestConfig(t *testing.T, p *testPKI, authClients string, withCA bool) *config.Config {
+	t.Helper()
+	cfg := config.New()
+	settings := [][2]string{
+		{"tls-cert-file", p.certFile},
+		{"tls-key-file", p.keyFile},
+		{"tls-auth-clients", authClients},
+	}
+	if withCA {
+		settings = append(settings, [2]string{"tls-ca-cert-file", p.caFile})
+	}
+	for _, s := range settings {
+		if err := cfg.Set(s[0], s[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+// handshake runs a TLS handshake between serverConfig and a client that
+// presents clientCert, if any, and returns the server's verdict.
+func handshake(t *testing.T, serverConfig *tls.Config, clientCert *tls.Certificate, roots *x509.CertPool) error {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	result := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			result <- err
+			return
+		}
+		defer conn.Close()
+		result <- conn.(*tls.Conn).Handshake()
+	}()
+
+	clientConfig := &tls.Config{RootCAs: roots, ServerName: "127.0.0.1"}
+	if clientCert != nil {
+		clientConfig.Certificates = []tls.Certificate{*clientCert}
+	}
+	if conn, err := tls.Dial("tcp", ln.Addr().String(), clientConfig); err == nil {
+		// With TLS 1.3 the client is done before the server has checked
+		// its certificate; the server's result is the one that counts.
+		defer conn.Close()
+	}
+	return <-result
+}
+
+func TestTLSConfigsAuthClients(t *testing.T) {
+	p := newTestPKI(t)
+	// A certificate from another CA, which the server must not trust.
+	other := newTestPKI(t)
+
+	tests := []struct {
+		mode       string
+		clientAuth tls.ClientAuthType
+		noCert     bool // handshake succeeds without a client certificate
+		trusted    bool // with one signed by tls-ca-cert-file
+		untrusted  bool // with one signed by another CA
+	}{
+		{"yes", tls.RequireAndVerifyClientCert, false, true, false},
+		{"optional", tls.VerifyClientCertIfGiven, true, true, false},
+		{"no", tls.NoClientCert, true, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			serverConfig, clientConfig, err := tlsConfigs(tlsTestConfig(t, p, tt.mode, true))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if serverConfig.ClientAuth != tt.clientAuth {
+				t.Errorf("ClientAuth = %v, want %v", serverConfig.ClientAuth, tt.clientAuth)
+			}
+			if len(clientConfig.Certificates) != 1 || clientConfig.RootCAs == nil {
+				t.Error("the replica side does not present the certificate or trust the CA")
+			}
+
+			for _, c := range []struct {
+				name string
+				cert *tls.Certificate
+				want bool
+			}{
+				{"no certificate", nil, tt.noCert},
+				{"trusted certificate", &p.cert, tt.trusted},
+				{"untrusted certificate", &other.cert, tt.untrusted},
+			} {
+				err := handshake(t, serverConfig, c.cert, p.pool)
+				if (err == nil) != c.want {
+					t.Errorf("%s: handshake error %v, want success %v", c.name, err, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestTLSConfigsErrors(t *testing.T) {
+	p := newTestPKI(t)
+
+	for _, mode := range []string{"yes", "optional"} {
+		if _, _, err := tlsConfigs(tlsTestConfig(t, p, mode, false)); err == nil {
+			t.Errorf("tls-auth-clients %s accepted without tls-ca-cert-file", mode)
+		}
+	}
+	if _, _, err := tlsConfigs(tlsTestConfig(t, p, "no", false)); err != nil {
+		t.Errorf("tls-auth-clients no without tls-ca-cert-file: %v", err)
+	}
+
+	missing := tlsTestConfig(t, p, "no", false)
+	if err := missing.Set("tls-cert-file", filepath.Join(t.TempDir(), "missing.crt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tlsConfigs(missing); err == nil {
+		t.Error("a missing certificate file was accepted")
+	}
+
+	notPEM := tlsTestConfig(t, p, "yes", true)
+	if err := notPEM.Set("tls-ca-cert-file", p.keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := tlsConfigs(notPEM); err == nil {
+		t.Error("a CA file without certificates was accepted")
+	}
+}
+
+// A replica with tls-replication dials its master over TLS, presenting its
+// certificate and checking the master's against tls-ca-cert-file.
+func TestDialMasterTLS(t *testing.T) {
+	p := newTestPKI(t)
+	serverConfig, clientConfig, err := tlsConfigs(tlsTestConfig(t, p, "yes", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err == nil && line == "PING\r\n" {
+			conn.Write([]byte("+PONG\r\n"))
+		}
+	}()
+
+	conn, err := dialMaster(ln.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, ok := conn.(*tls.Conn); !ok {
+		t.Fatalf("dialMaster returned a %T", conn)
+	}
+	if _, err := conn.Write([]byte("PING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || reply != "+PONG\r\n" {
+		t.Fatalf("reply %q, %v", reply, err)
+	}
+}
+
+// The master's certificate must chain to tls-ca-cert-file.
+func TestDialMasterUntrusted(t *testing.T) {
+	p, other := newTestPKI(t), newTestPKI(t)
+	serverConfig, _, err := tlsConfigs(tlsTestConfig(t, p, "no", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, clientConfig, err := tlsConfigs(tlsTestConfig(t, other, "no", true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	if conn, err := dialMaster(ln.Addr().String(), clientConfig); err == nil {
+		conn.Close()
+		t.Fatal("dialMaster accepted a master signed by another CA")
+	}
+}
+
+func TestDialMasterPlain(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	conn, err := dialMaster(ln.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, ok := conn.(*tls.Conn); ok {
+		t.Fatal("dialMaster used TLS without tls-replication")
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
+)
+
+// listenUnix listens on a Unix domain socket, replacing a stale socket file
+// left behind by a previous run. perm is an octal mode such as "700".
+func listenUnix(path, perm string) (net.Listener, error) {
+	var mode fs.FileMode
+	if perm != "" && perm != "0" {
+		n, err := strconv.ParseUint(perm, 8, 32)
+		if err != nil || n > 0o777 {
+			return nil, fmt.Errorf("invalid unixsocketperm %q", perm)
+		}
+		mode = fs.FileMode(n)
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&fs.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if mode != 0 {
+		if err := os.Chmod(path, mode); err != nil {
+			l.Close()
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// shutdownOnSignal closes the listeners on SIGINT or SIGTERM, which also
+// removes the Unix socket file, and exits.
+func shutdownOnSignal(listeners []net.Listener) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Warning("Received signal, shutting down", "signal", sig.String())
+		for _, l := range listeners {
+			l.Close()
+		}
+		os.Exit(0)
+	}()
+}
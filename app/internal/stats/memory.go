@@ -0,0 +1,23 @@
+package stats
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+var usedMemoryPeak atomic.Uint64
+
+// Memory returns the heap in use, the memory obtained from the OS and the
+// highest heap usage seen by Memory so far. Like Redis' used_memory, the
+// figure is what the server has allocated, not the process RSS.
+func Memory() (used, sys, peak uint64) {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	used = m.HeapAlloc
+	peak = usedMemoryPeak.Load()
+	for used > peak && !usedMemoryPeak.CompareAndSwap(peak, used) {
+		peak = usedMemoryPeak.Load()
+	}
+	return used, m.Sys, max(peak, used)
+}
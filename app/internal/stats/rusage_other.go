@@ -0,0 +1,10 @@
+//go:build !unix
+
+package stats
+
+import "time"
+
+// CPU is not available on this platform and reports zero.
+func CPU() (sys, user, childSys, childUser time.Duration) {
+	return 0, 0, 0, 0
+}
@@ -0,0 +1,18 @@
+//go:build unix
+
+package stats
+
+import (
+	"syscall"
+	"time"
+)
+
+// CPU returns the system and user CPU time used by the server and by its
+// finished child processes.
+func CPU() (sys, user, childSys, childUser time.Duration) {
+	var self, children syscall.Rusage
+	syscall.Getrusage(syscall.RUSAGE_SELF, &self)
+	syscall.Getrusage(syscall.RUSAGE_CHILDREN, &children)
+	return time.Duration(self.Stime.Nano()), time.Duration(self.Utime.Nano()),
+		time.Duration(children.Stime.Nano()), time.Duration(children.Utime.Nano())
+}
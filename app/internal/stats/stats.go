@@ -0,0 +1,167 @@
+// Package stats holds the server-wide counters reported by INFO: command
+// calls and latency, error replies, connections and keyspace events. The
+// counters are plain atomics so any package can bump them without locking.
+package stats
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StartTime is when the server started, for uptime_in_seconds.
+var StartTime = time.Now()
+
+var (
+	ConnectionsReceived atomic.Int64
+	RejectedConnections atomic.Int64
+	CommandsProcessed   atomic.Int64
+	ErrorReplies        atomic.Int64
+	ExpiredKeys         atomic.Int64
+	EvictedKeys         atomic.Int64
+	KeyspaceHits        atomic.Int64
+	KeyspaceMisses      atomic.Int64
+	NetInputBytes       atomic.Int64
+	NetOutputBytes      atomic.Int64
+)
+
+// LatencyBuckets are the upper bounds of the command latency histogram.
+// Calls slower than the last bound are only counted in Calls.
+var LatencyBuckets = [...]time.Duration{
+	10 * time.Microsecond, 25 * time.Microsecond, 50 * time.Microsecond,
+	100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+}
+
+// Command is the commandstats entry of one command.
+type Command struct {
+	Calls         atomic.Int64
+	Usec          atomic.Int64
+	RejectedCalls atomic.Int64
+	FailedCalls   atomic.Int64
+
+	// buckets[i] counts the calls that took at most LatencyBuckets[i] but
+	// longer than LatencyBuckets[i-1].
+	buckets [len(LatencyBuckets)]atomic.Int64
+}
+
+// Histogram returns the cumulative number of calls at or under each of
+// LatencyBuckets, as Prometheus histograms expect.
+func (c *Command) Histogram() []int64 {
+	counts := make([]int64, len(LatencyBuckets))
+	var total int64
+	for i := range counts {
+		total += c.buckets[i].Load()
+		counts[i] = total
+	}
+	return counts
+}
+
+var (
+	mu          sync.RWMutex
+	commands    = map[string]*Command{}
+	errorCounts = map[string]*atomic.Int64{}
+)
+
+// Cmd returns the entry for the command name, creating it on first use.
+// Names are stored lower-cased, as Redis reports them.
+func Cmd(name string) *Command {
+	mu.RLock()
+	c, ok := commands[name]
+	mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if c, ok = commands[name]; !ok {
+		c = &Command{}
+		commands[name] = c
+	}
+	return c
+}
+
+// RecordCall accounts for one execution of the command name that took d.
+// failed is set when the command replied with an error.
+func RecordCall(name string, d time.Duration, failed bool) {
+	c := Cmd(strings.ToLower(name))
+	c.Calls.Add(1)
+	c.Usec.Add(d.Microseconds())
+	if i := sort.Search(len(LatencyBuckets), func(i int) bool { return d <= LatencyBuckets[i] }); i < len(LatencyBuckets) {
+		c.buckets[i].Add(1)
+	}
+	if failed {
+		c.FailedCalls.Add(1)
+	}
+	CommandsProcessed.Add(1)
+}
+
+// RecordRejected accounts for a call refused before it ran, such as a
+// regular command sent by a RESP2 client in subscribe mode.
+func RecordRejected(name string) {
+	Cmd(strings.ToLower(name)).RejectedCalls.Add(1)
+}
+
+// RecordError accounts for an error reply with the given code, e.g. "ERR"
+// or "WRONGTYPE".
+func RecordError(code string) {
+	ErrorReplies.Add(1)
+
+	mu.RLock()
+	n, ok := errorCounts[code]
+	mu.RUnlock()
+	if !ok {
+		mu.Lock()
+		if n, ok = errorCounts[code]; !ok {
+			n = new(atomic.Int64)
+			errorCounts[code] = n
+		}
+		mu.Unlock()
+	}
+	n.Add(1)
+}
+
+// CommandNames returns the commands seen so far, sorted.
+func CommandNames() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Errors returns the number of error replies per error code.
+func Errors() map[string]int64 {
+	mu.RLock()
+	defer mu.RUnlock()
+	counts := make(map[string]int64, len(errorCounts))
+	for code, n := range errorCounts {
+		counts[code] = n.Load()
+	}
+	return counts
+}
+
+// Reset clears every counter, as CONFIG RESETSTAT does. Uptime is kept.
+func Reset() {
+	for _, n := range []*atomic.Int64{
+		&ConnectionsReceived, &RejectedConnections, &CommandsProcessed, &ErrorReplies,
+		&ExpiredKeys, &EvictedKeys, &KeyspaceHits, &KeyspaceMisses,
+		&NetInputBytes, &NetOutputBytes,
+	} {
+		n.Store(0)
+	}
+
+	mu.Lock()
+	commands = map[string]*Command{}
+	errorCounts = map[string]*atomic.Int64{}
+	mu.Unlock()
+}
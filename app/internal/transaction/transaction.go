@@ -5,6 +5,7 @@ import "sync"
 type Transaction struct {
 	Commands []CommandQueue
 	mu       sync.Mutex
+	aborted  bool
 }
 
 type CommandQueue struct {
@@ -20,8 +21,23 @@ func NewTransaction() *Transaction {
 func (t *Transaction) AddCommand(name string, args []string) {
 	t.mu.Lock()
 	defer t.mu.Unlock()
+	// args may be backed by a connection's reusable read buffer, so keep a copy.
 	t.Commands = append(t.Commands, CommandQueue{
 		Name: name,
-		Args: args,
+		Args: append([]string(nil), args...),
 	})
 }
+
+// Abort flags the transaction after a queuing error so that EXEC refuses
+// to run it.
+func (t *Transaction) Abort() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.aborted = true
+}
+
+func (t *Transaction) Aborted() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.aborted
+}
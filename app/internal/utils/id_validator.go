@@ -12,7 +12,7 @@ func ValidateStreamID(ID, lastID string) (string, error) {
 	case "*":
 		return fmt.Sprintf("%d-%d", time.Now().UnixMilli(), 0), nil
 	case "0-0":
-		return "", fmt.Errorf(" The ID specified in XADD must be greater than 0-0")
+		return "", fmt.Errorf("The ID specified in XADD must be greater than 0-0")
 	}
 
 	if lastID == "" {
@@ -59,7 +59,7 @@ func ValidateStreamID(ID, lastID string) (string, error) {
 	}
 
 	if IDMs < lastMs || (IDMs == lastMs && intIDSeq <= intLastSeq) {
-		return "", fmt.Errorf(" The ID specified in XADD is equal or smaller than the target stream top item")
+		return "", fmt.Errorf("The ID specified in XADD is equal or smaller than the target stream top item")
 	}
 
 	return ID, nil
@@ -1,68 +1,11 @@
 package utils
 
 import (
-	"bufio"
 	"fmt"
-	"io"
-	"log"
 	"strconv"
 	"strings"
 )
 
-func ParseArgs(reader *bufio.Reader) []string {
-	line, err := reader.ReadString('\n')
-	if err != nil {
-		if err == io.EOF {
-			return nil
-		}
-		log.Print(err)
-		return nil
-	}
-
-	if len(line) < 2 || line[0] != '*' {
-		log.Printf("Invalid RESP format: %s", line)
-		return nil
-	}
-
-	var arrayLength int
-	_, err = fmt.Sscanf(line, "*%d\r\n", &arrayLength)
-	if err != nil {
-		log.Printf("Failed to parse array length: %v", err)
-		return nil
-	}
-
-	args := make([]string, arrayLength)
-	for i := 0; i < arrayLength; i++ {
-		lengthLine, err := reader.ReadString('\n')
-		if err != nil {
-			log.Print(err)
-			return nil
-		}
-
-		if len(lengthLine) < 2 || lengthLine[0] != '$' {
-			log.Printf("Invalid bulk string format: %s", lengthLine)
-			return nil
-		}
-
-		var strLen int
-		_, err = fmt.Sscanf(lengthLine, "$%d\r\n", &strLen)
-		if err != nil {
-			log.Printf("Failed to parse string length: %v", err)
-			return nil
-		}
-
-		arg := make([]byte, strLen+2)
-		_, err = io.ReadFull(reader, arg)
-		if err != nil {
-			log.Print(err)
-			return nil
-		}
-
-		args[i] = string(arg[:strLen])
-	}
-	return args
-}
-
 func ParsID(id string) (int64, int64) {
 	parts := strings.Split(id, "-")
 	ms, _ := strconv.ParseInt(parts[0], 10, 64)
@@ -77,3 +20,50 @@ func ParsReplicaOf(replicaOf string) string {
 	}
 	return fmt.Sprintf("%s:%s", parts[0], parts[1])
 }
+
+// ParseMemory parses a Redis style memory amount such as "64mb" or "1gb".
+// Units are case insensitive: k/m/g are powers of 1000, kb/mb/gb powers of 1024.
+func ParseMemory(s string) (int64, error) {
+	lower := strings.ToLower(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		mul    int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+		{"b", 1},
+	} {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			multiplier = unit.mul
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory amount: %q", s)
+	}
+	return n * multiplier, nil
+}
+
+// ParseOutputBufferLimit parses "<class> <hard> <soft> <seconds>" as used by
+// the client-output-buffer-limit option.
+func ParseOutputBufferLimit(limit string) (class string, hard, soft, seconds int64, err error) {
+	parts := strings.Fields(limit)
+	if len(parts) != 4 {
+		return "", 0, 0, 0, fmt.Errorf("expected '<class> <hard> <soft> <seconds>', got %q", limit)
+	}
+	class = strings.ToLower(parts[0])
+	if hard, err = ParseMemory(parts[1]); err != nil {
+		return "", 0, 0, 0, err
+	}
+	if soft, err = ParseMemory(parts[2]); err != nil {
+		return "", 0, 0, 0, err
+	}
+	seconds, err = strconv.ParseInt(parts[3], 10, 64)
+	if err != nil || seconds < 0 {
+		return "", 0, 0, 0, fmt.Errorf("invalid soft limit seconds: %q", parts[3])
+	}
+	return class, hard, soft, seconds, nil
+}
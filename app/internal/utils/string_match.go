@@ -0,0 +1,128 @@
+package utils
+
+// StringMatch reports whether s matches the glob-style pattern the way
+// Redis' stringmatchlen does, for KEYS, SCAN, PSUBSCRIBE and CONFIG GET:
+//
+//	?      any single byte
+//	*      any sequence of bytes, including none
+//	[abc]  one of the bytes; [^abc] any byte but these; [a-z] a range
+//	\x     the byte x literally, also inside brackets
+//
+// Unlike path.Match, '/' is not special and malformed patterns are never an
+// error: an unterminated bracket ends at the end of the pattern and a
+// trailing backslash is literal. Matching is per byte and, with nocase, ASCII
+// case-insensitive.
+func StringMatch(pattern, s string, nocase bool) bool {
+	skipLongerMatches := false
+	return stringMatch(pattern, s, nocase, &skipLongerMatches, 0)
+}
+
+func stringMatch(pattern, s string, nocase bool, skipLongerMatches *bool, nesting int) bool {
+	// Protection against abusive patterns.
+	if nesting > 1000 {
+		return false
+	}
+
+	for len(pattern) > 0 && len(s) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for len(s) > 0 {
+				if stringMatch(pattern[1:], s, nocase, skipLongerMatches, nesting+1) {
+					return true
+				}
+				if *skipLongerMatches {
+					return false
+				}
+				s = s[1:]
+			}
+			// The rest of the pattern matches nowhere in the rest of s, so
+			// letting an earlier '*' swallow more of s cannot help either.
+			*skipLongerMatches = true
+			return false
+		case '?':
+			s = s[1:]
+		case '[':
+			pattern = pattern[1:]
+			not := len(pattern) > 0 && pattern[0] == '^'
+			if not {
+				pattern = pattern[1:]
+			}
+			match := false
+			for {
+				if len(pattern) == 0 {
+					// Unterminated: leave the closing byte for the outer loop
+					// to consume, as Redis steps back onto its terminator.
+					pattern = " "
+					break
+				} else if pattern[0] == '\\' && len(pattern) >= 2 {
+					pattern = pattern[1:]
+					if pattern[0] == s[0] {
+						match = true
+					}
+				} else if pattern[0] == ']' {
+					break
+				} else if len(pattern) >= 3 && pattern[1] == '-' {
+					start, end, c := pattern[0], pattern[2], s[0]
+					if start > end {
+						start, end = end, start
+					}
+					if nocase {
+						start, end, c = toLower(start), toLower(end), toLower(c)
+					}
+					pattern = pattern[2:]
+					if c >= start && c <= end {
+						match = true
+					}
+				} else if equalByte(pattern[0], s[0], nocase) {
+					match = true
+				}
+				pattern = pattern[1:]
+			}
+			if not {
+				match = !match
+			}
+			if !match {
+				return false
+			}
+			s = s[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if !equalByte(pattern[0], s[0], nocase) {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+		if len(s) == 0 {
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			break
+		}
+	}
+	return len(pattern) == 0 && len(s) == 0
+}
+
+func equalByte(a, b byte, nocase bool) bool {
+	if nocase {
+		return toLower(a) == toLower(b)
+	}
+	return a == b
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// The expectations are those of Redis' stringmatchlen, including the
+// malformed patterns it tolerates.
+func TestStringMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		nocase     bool
+		want       bool
+	}{
+		{"", "", false, true},
+		{"", "a", false, false},
+		{"a", "", false, false},
+		{"hello", "hello", false, true},
+		{"hello", "hell", false, false},
+
+		// * matches any sequence, including none and '/'.
+		{"*", "", false, false}, // Redis never matches an empty string; KEYS special-cases *
+		{"**", "", false, false},
+		{"a*", "a", false, true},
+		{"*", "anything", false, true},
+		{"h*o", "hello", false, true},
+		{"h*o", "hell", false, false},
+		{"*llo", "hello", false, true},
+		{"a*b", "ab", false, true},
+		{"a*b*c", "aXbYc", false, true},
+		{"a*b*c", "aXbYcZ", false, false},
+		{"a*c", "a/b/c", false, true},
+		{"user:*:name", "user:1000:name", false, true},
+
+		// ? matches exactly one byte.
+		{"?", "a", false, true},
+		{"?", "", false, false},
+		{"?", "ab", false, false},
+		{"h?llo", "hallo", false, true},
+		{"h??lo", "hello", false, true},
+		{"*?", "", false, false},
+
+		// Brackets.
+		{"h[ae]llo", "hello", false, true},
+		{"h[ae]llo", "hillo", false, false},
+		{"h[^e]llo", "hallo", false, true},
+		{"h[^e]llo", "hello", false, false},
+		{"h[a-b]llo", "hbllo", false, true},
+		{"h[a-b]llo", "hcllo", false, false},
+		{"[z-a]", "m", false, true}, // a reversed range is swapped
+		{"[^z-a]", "m", false, false},
+		{"[a-]", "_", false, true}, // the range from ']' to 'a', unterminated
+		{"[a-]", "-", false, false},
+		{"[]", "a", false, false},
+		{"[]]", "]", false, false}, // ']' closes the bracket at once
+
+		// Backslash escapes, also inside brackets.
+		{`\*`, "*", false, true},
+		{`\*`, "a", false, false},
+		{`h\?llo`, "h?llo", false, true},
+		{`h\?llo`, "hallo", false, false},
+		{`\[a]`, "[a]", false, true},
+		{`[\]]`, "]", false, true},
+		{`[a\-z]`, "-", false, true},
+		{`[a\-z]`, "b", false, false},
+		{`\\`, `\`, false, true},
+
+		// Malformed patterns are not errors.
+		{"[abc", "a", false, true}, // an unterminated bracket ends with the pattern
+		{"[abc", "ab", false, false},
+		{"[abc", "d", false, false},
+		{"[^abc", "d", false, true},
+		{"[", "a", false, false},
+		{"[^", "a", false, true},
+		{"[a-", "-", false, true},
+		{`a\`, `a\`, false, true}, // a trailing backslash is literal
+		{`a\`, "a", false, false},
+
+		// nocase folds ASCII letters only.
+		{"HELLO", "hello", true, true},
+		{"HELLO", "hello", false, false},
+		{"h[A-C]llo", "hbllo", true, true},
+		{"h[A-C]llo", "hbllo", false, false},
+		{"[^a]", "A", true, false},
+		{"*É*", "é", true, false},
+
+		// Matching is per byte.
+		{"?", "é", false, false},
+		{"??", "é", false, true},
+	}
+	for _, tt := range tests {
+		if got := StringMatch(tt.pattern, tt.s, tt.nocase); got != tt.want {
+			t.Errorf("StringMatch(%q, %q, %v) = %v, want %v", tt.pattern, tt.s, tt.nocase, got, tt.want)
+		}
+	}
+}
+
+// A pattern with many stars against a string it cannot match must fail
+// without backtracking through every way of splitting the string.
+func TestStringMatchManyStars(t *testing.T) {
+	pattern := strings.Repeat("a*", 30) + "b"
+	if StringMatch(pattern, strings.Repeat("a", 100), false) {
+		t.Fatal("matched")
+	}
+}
@@ -5,21 +5,57 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"strings"
 
+	"github.com/codecrafters-io/redis-starter-go/app/internal/config"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/logger"
 	"github.com/codecrafters-io/redis-starter-go/app/internal/server"
 )
 
 // Ensures gofmt doesn't remove the "net" and "os" imports in stage 1 (feel free to remove this!)
 var _ = net.Listen
 var _ = os.Exit
-var port = flag.String("port", "6379", "Port for redis server")
-var replicaOf = flag.String("replicaof", "", "Defines replica of master redis server")
-var dir = flag.String("dir", "/tmp", "The path to the directory where the RDB file is stored")
-var dbFileName = flag.String("dbfilename", "redis-data.rdb", "The name of the RDB file")
 
 func main() {
-	fmt.Println("Logs from your program will appear here!")
-	flag.Parse()
+	cfg := config.New()
 
-	server.Start(*port, *replicaOf, *dir, *dbFileName)
+	// Every parameter is also a flag. Flags override the config file, so
+	// they are only applied once it has been loaded.
+	var overrides [][2]string
+	for _, p := range cfg.Params() {
+		name := p.Name
+		usage := p.Usage
+		if p.Default != "" {
+			usage += fmt.Sprintf(" (default %q)", p.Default)
+		}
+		flag.Func(name, usage, func(value string) error {
+			overrides = append(overrides, [2]string{name, value})
+			return nil
+		})
+	}
+
+	// As with redis-server, the config file may come first:
+	// "./your_program.sh /etc/redis.conf -port 7000".
+	args := os.Args[1:]
+	var configFile string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		configFile, args = args[0], args[1:]
+	}
+	flag.CommandLine.Parse(args)
+	if configFile == "" && flag.NArg() > 0 {
+		configFile = flag.Arg(0)
+	}
+
+	if configFile != "" {
+		if err := cfg.LoadFile(configFile); err != nil {
+			logger.Fatal("Bad config file", "file", configFile, "err", err)
+		}
+	}
+	for _, o := range overrides {
+		if err := cfg.Set(o[0], o[1]); err != nil {
+			logger.Fatal("Invalid option", "option", o[0], "value", o[1], "err", err)
+		}
+	}
+
+	server.Start(cfg)
 }